@@ -0,0 +1,16 @@
+package common
+
+import "context"
+
+type requestIdKey struct{}
+
+// WithRequestId returns a context carrying the id of the HTTP request it is used for.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestId returns the id of the HTTP request that `ctx` is used for, or an empty string if there is none.
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
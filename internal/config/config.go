@@ -17,6 +17,25 @@ const (
 	EnvProduction  = "production"
 )
 
+// Database drivers. With sqlite, the database url is the database name (or :memory:) and features that need postgres are disabled.
+const (
+	DatabasePostgres = "postgres"
+	DatabaseSqlite   = "sqlite"
+)
+
+// KV store backends.
+const (
+	KVStoreSqlite = "sqlite"
+	KVStoreMemory = "memory"
+	KVStoreRedis  = "redis"
+)
+
+const (
+	SignUpOpen       = "open"
+	SignUpInviteOnly = "invite-only"
+	SignUpClosed     = "closed"
+)
+
 // This is set at build time.
 var BuildId string
 
@@ -26,6 +45,7 @@ type Server struct {
 	Host               string         `json:"host" validate:"required,ip"`
 	Port               string         `json:"port" validate:"required,gte=0"`
 	SessionSecret      string         `json:"sessionSecret" validate:"required"`
+	DatabaseDriver     string         `json:"databaseDriver" validate:"required,oneof=postgres sqlite"`
 	DatabaseUrl        string         `json:"databaseUrl" validate:"required"`
 	SmtpHost           string         `json:"smtpHost" validate:"required"`
 	SmtpUsername       string         `json:"smtpUsername" validate:"required"`
@@ -37,10 +57,41 @@ type Server struct {
 	AwsAccessKeySecret string         `json:"awsAccessKeySecret"`
 	GoogleClientId     string         `json:"googleClientId"`
 	GoogleClientSecret string         `json:"googleClientSecret"`
+	SignUpMode         string         `json:"signUpMode" validate:"required,oneof=open invite-only closed"`
 	AllowedOrigins     []string       `json:"allowedOrigins" validate:"required"`
 	ShutdownTimeout    time.Duration  `json:"shutdownTimeout" validate:"required"`
 	RateLimitPerMinute int            `json:"rateLimitPerMinute" validate:"required"`
 	SmtpPort           int            `json:"smtpPort" validate:"required"`
+	// Connection pool settings of the postgres database.
+	DatabaseMaxOpenConns    int           `json:"databaseMaxOpenConns" validate:"gte=0"`
+	DatabaseMaxIdleConns    int           `json:"databaseMaxIdleConns" validate:"gte=0"`
+	DatabaseConnMaxLifetime time.Duration `json:"databaseConnMaxLifetime"`
+	DatabaseConnMaxIdleTime time.Duration `json:"databaseConnMaxIdleTime"`
+	DatabaseConnectTimeout  time.Duration `json:"databaseConnectTimeout" validate:"required"`
+	DatabaseConnectRetries  int           `json:"databaseConnectRetries" validate:"gte=0"`
+	// DatabaseSlowQueryThreshold is the duration from which queries are logged as slow. Zero disables the log.
+	DatabaseSlowQueryThreshold time.Duration `json:"databaseSlowQueryThreshold"`
+	// DatabaseReplicaUrls are the read replicas of the postgres database. Read-only queries are spread across them.
+	DatabaseReplicaUrls []string `json:"databaseReplicaUrls"`
+	// PiiKeys maps key ids to base64 encoded AES keys for encrypting PII. PiiKeyId is the key new values are encrypted with. Encryption is disabled if it is empty.
+	PiiKeys  map[string]string `json:"piiKeys"`
+	PiiKeyId string            `json:"piiKeyId"`
+	// PiiIndexKey is the base64 encoded HMAC key of blind indexes. It cannot be rotated.
+	PiiIndexKey string `json:"piiIndexKey"`
+	// OutboxSink is where the events of the outbox are relayed to: "log", "webhook" (OutboxWebhookUrl, signed with OutboxWebhookSecret if set) or "file" (OutboxFilePath).
+	OutboxSink          string `json:"outboxSink" validate:"oneof=log webhook file"`
+	OutboxWebhookUrl    string `json:"outboxWebhookUrl" validate:"required_if=OutboxSink webhook,omitempty,url"`
+	OutboxWebhookSecret string `json:"outboxWebhookSecret"`
+	OutboxFilePath      string `json:"outboxFilePath" validate:"required_if=OutboxSink file"`
+	// JobWorkers is how many background jobs are run at the same time. Zero disables running jobs in this instance.
+	JobWorkers int `json:"jobWorkers" validate:"gte=0"`
+	// KVStoreBackend is where the KV store keeps its keys: "sqlite" (a database file named KVStoreSqliteName, "kv" by default, or :memory:), "memory" (local to the instance) or "redis" (a Redis-compatible server at KVStoreRedisAddr, shared across instances).
+	// Sessions are kept in it, so with "memory" or sqlite :memory:, every restart logs out all users. With more than one instance, only "redis" works, as a session is otherwise only known to the instance that created it.
+	KVStoreBackend       string `json:"kvStoreBackend" validate:"oneof=sqlite memory redis"`
+	KVStoreSqliteName    string `json:"kvStoreSqliteName" validate:"required_if=KVStoreBackend sqlite"`
+	KVStoreRedisAddr     string `json:"kvStoreRedisAddr" validate:"required_if=KVStoreBackend redis,omitempty,hostname_port"`
+	KVStoreRedisPassword string `json:"kvStoreRedisPassword"`
+	KVStoreRedisDB       int    `json:"kvStoreRedisDB" validate:"gte=0"`
 }
 
 type Client struct {
@@ -69,6 +120,32 @@ func Load() (*Server, error) {
 		}
 	}
 
+	if m["databaseDriver"] == nil {
+		m["databaseDriver"] = DatabasePostgres
+	}
+
+	if m["signUpMode"] == nil {
+		m["signUpMode"] = SignUpOpen
+	}
+
+	for key, value := range map[string]any{
+		"databaseMaxOpenConns":       25,
+		"databaseMaxIdleConns":       25,
+		"databaseConnMaxLifetime":    "30m",
+		"databaseConnMaxIdleTime":    "5m",
+		"databaseConnectTimeout":     "5s",
+		"databaseConnectRetries":     5,
+		"databaseSlowQueryThreshold": "200ms",
+		"outboxSink":                 "log",
+		"jobWorkers":                 4,
+		"kvStoreBackend":             KVStoreSqlite,
+		"kvStoreSqliteName":          "kv",
+	} {
+		if m[key] == nil {
+			m[key] = value
+		}
+	}
+
 	var errList []error
 
 	if m["accessTokenExpiresIn"] != nil {
@@ -95,6 +172,14 @@ func Load() (*Server, error) {
 		m["shutdownTimeout"] = shutdownTimeout
 	}
 
+	for _, key := range [...]string{"databaseConnMaxLifetime", "databaseConnMaxIdleTime", "databaseConnectTimeout", "databaseSlowQueryThreshold"} {
+		d, err := time.ParseDuration(fmt.Sprint(m[key]))
+		if err != nil {
+			errList = append(errList, fmt.Errorf("could not parse %s: %w", key, err))
+		}
+		m[key] = d
+	}
+
 	if len(errList) > 0 {
 		return nil, errors.Join(errList...)
 	}
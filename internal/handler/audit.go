@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+// audit records a security audit event for the current request. The actor is the logged in user, if any. Failures are logged and do not fail the request. Without a postgres repo, nothing is recorded.
+func (h *handler) audit(c echo.Context, action string, targetId string, metadata map[string]any) {
+	if h.repo == nil {
+		return
+	}
+	event := &repo.AuditEvent{
+		TargetId:  targetId,
+		Action:    action,
+		Ip:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		RequestId: c.Response().Header().Get(echo.HeaderXRequestID),
+		Metadata:  metadata,
+	}
+	if user, ok := c.Get("user").(*repo.User); ok && user != nil {
+		event.ActorId = user.Id
+	}
+	if _, err := h.repo.CreateAuditEvent(c.Request().Context(), event); err != nil {
+		slog.ErrorContext(c.Request().Context(), "create audit event", slog.String("action", action), slog.Any("error", err))
+	}
+}
+
+type auditEventsResponse struct {
+	Events     []repo.AuditEvent `json:"events"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+type getAuditEventsRequest struct {
+	ActorId  string `query:"actor_id"`
+	TargetId string `query:"target_id"`
+	Action   string `query:"action"`
+	Since    string `query:"since"`
+	Until    string `query:"until"`
+	Cursor   string `query:"cursor"`
+	Limit    int    `query:"limit" validate:"omitempty,gte=1,lte=200"`
+}
+
+// @Summary Get audit events
+// @Description Get security audit events, newest first. Filter by actor, target, action and time range (RFC 3339), and paginate using the returned cursor.
+// @Security ApiKeyAuth
+// @Router /v1/admin/audit [get]
+// @Success 200 {object} auditEventsResponse
+// @Failure 401 {string} string "invalid session"
+func (h *handler) GetAuditEvents(c echo.Context) error {
+	req := new(getAuditEventsRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	filter := &repo.AuditEventFilter{
+		ActorId:  req.ActorId,
+		TargetId: req.TargetId,
+		Action:   req.Action,
+		Cursor:   req.Cursor,
+		Limit:    req.Limit,
+	}
+	var err error
+	if req.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, req.Since); err != nil {
+			return c.String(http.StatusUnprocessableEntity, "invalid since time")
+		}
+	}
+	if req.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, req.Until); err != nil {
+			return c.String(http.StatusUnprocessableEntity, "invalid until time")
+		}
+	}
+	return h.writeAuditEvents(c, filter)
+}
+
+type getSecurityEventsRequest struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,gte=1,lte=200"`
+}
+
+// @Summary Get security events
+// @Description Get the security events of the current user, newest first.
+// @Security ApiKeyAuth
+// @Router /v1/me/security-events [get]
+// @Success 200 {object} auditEventsResponse
+// @Failure 401 {string} string "invalid session"
+func (h *handler) GetSecurityEvents(c echo.Context) error {
+	req := new(getSecurityEventsRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user := c.Get("user").(*repo.User)
+	return h.writeAuditEvents(c, &repo.AuditEventFilter{
+		UserId: user.Id,
+		Cursor: req.Cursor,
+		Limit:  req.Limit,
+	})
+}
+
+func (h *handler) writeAuditEvents(c echo.Context, filter *repo.AuditEventFilter) error {
+	events, nextCursor, err := h.repo.GetAuditEvents(c.Request().Context(), filter)
+	if err != nil {
+		if errors.Is(err, repo.ErrInvalidCursor) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, auditEventsResponse{Events: events, NextCursor: nextCursor})
+}
@@ -1,42 +1,111 @@
 package handler
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/pkg/cryptoutil"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
 	"github.com/rohitxdev/go-api-starter/pkg/repo"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	sessionMaxAge = 86400 * 7 // 7 days
+	sessionMaxAge          = 86400 * 7 // 7 days
+	sessionsNamespace      = "sessions"
+	passwordResetKeyPrefix = "password_reset:"
+	passwordResetExpiry    = time.Minute * 10
 )
 
 var (
 	ErrUserNotLoggedIn = errors.New("user is not logged in")
+	ErrSessionRevoked  = errors.New("session has been revoked")
+	ErrSignUpClosed    = errors.New("sign up is closed")
+	ErrInviteRequired  = errors.New("sign up requires an invite")
 )
 
-func createSession(c echo.Context, userId string) (*sessions.Session, error) {
+// sessions returns the store of the sessions. Each session is a key "<user id>:<session id>", so that the sessions of a user can be revoked by deleting the keys with the user's prefix.
+func (h *handler) sessions() kvstore.Store {
+	return h.kvStore.Namespace(sessionsNamespace)
+}
+
+func sessionKey(userId string, sessionId string) string {
+	return userId + ":" + sessionId
+}
+
+func (h *handler) createSession(c echo.Context, userId string) (*sessions.Session, error) {
 	sess, err := session.Get("session", c)
 	if err != nil {
 		return nil, err
 	}
+	sessionId := id.New(id.Session)
+	if err = h.sessions().Set(c.Request().Context(), sessionKey(userId, sessionId), "1", sessionMaxAge*time.Second); err != nil {
+		return nil, err
+	}
 	sess.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   sessionMaxAge,
 		HttpOnly: true,
 	}
 	sess.Values["user_id"] = userId
+	sess.Values["session_id"] = sessionId
+	sess.Values["auth_time"] = time.Now().Unix()
 	if err := sess.Save(c.Request(), c.Response()); err != nil {
 		return nil, err
 	}
 	return sess, nil
 }
 
+// sessionUserId returns the id of the logged in user. Sessions that are not in the store, because they were revoked or have expired, are rejected.
+func (h *handler) sessionUserId(c echo.Context) (string, error) {
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return "", err
+	}
+	userId, ok := sess.Values["user_id"].(string)
+	if !ok {
+		return "", ErrUserNotLoggedIn
+	}
+	sessionId, ok := sess.Values["session_id"].(string)
+	if !ok {
+		if err = h.upgradeLegacySession(c, sess, userId); err != nil {
+			return "", err
+		}
+		return userId, nil
+	}
+	if _, err = h.sessions().Get(c.Request().Context(), sessionKey(userId, sessionId)); err != nil {
+		if errors.Is(err, kvstore.ErrKeyNotFound) {
+			return "", ErrSessionRevoked
+		}
+		return "", err
+	}
+	return userId, nil
+}
+
+// upgradeLegacySession stores a session created before sessions were stored, whose cookie only has the user id, and saves the new session id in its cookie. Legacy sessions have all expired sessionMaxAge after the upgrade, after which this can be removed.
+func (h *handler) upgradeLegacySession(c echo.Context, sess *sessions.Session, userId string) error {
+	sessionId := id.New(id.Session)
+	if err := h.sessions().Set(c.Request().Context(), sessionKey(userId, sessionId), "1", sessionMaxAge*time.Second); err != nil {
+		return err
+	}
+	sess.Values["session_id"] = sessionId
+	return sess.Save(c.Request(), c.Response())
+}
+
+// revokeSessions invalidates all existing sessions of the user.
+func (h *handler) revokeSessions(ctx context.Context, userId string) error {
+	_, err := h.sessions().DeletePrefix(ctx, sessionKey(userId, ""))
+	return err
+}
+
 func (h *handler) LogOut(c echo.Context) error {
 	sess, err := session.Get("session", c)
 	if err != nil {
@@ -47,9 +116,17 @@ func (h *handler) LogOut(c echo.Context) error {
 		MaxAge:   -1,
 		HttpOnly: true,
 	}
+	userId, _ := sess.Values["user_id"].(string)
+	sessionId, _ := sess.Values["session_id"].(string)
 	if err := sess.Save(c.Request(), c.Response()); err != nil {
 		return err
 	}
+	if userId != "" {
+		if err := h.sessions().Delete(c.Request().Context(), sessionKey(userId, sessionId)); err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		h.audit(c, repo.AuditLogOut, userId, nil)
+	}
 	return c.String(http.StatusOK, "Logged out")
 }
 
@@ -63,22 +140,35 @@ func (h *handler) LogIn(c echo.Context) error {
 	if err := bindAndValidate(c, req); err != nil {
 		return err
 	}
-	user, err := h.repo.GetUserByEmail(c.Request().Context(), sanitizeEmail(req.Email))
+	user, err := h.users.GetUserByEmail(c.Request().Context(), sanitizeEmail(req.Email))
 	if err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			h.audit(c, repo.AuditLogInFailed, "", map[string]any{"email": req.Email, "reason": "unknown email"})
+		}
 		return err
 	}
 	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.audit(c, repo.AuditLogInFailed, user.Id, map[string]any{"reason": "wrong password"})
 		return c.String(http.StatusUnauthorized, err.Error())
 	}
-	if _, err := createSession(c, user.Id); err != nil {
+	if _, err := h.createSession(c, user.Id); err != nil {
 		return err
 	}
+	c.Set("user", user)
+	h.audit(c, repo.AuditLogIn, user.Id, nil)
+	h.checkNewDevice(c, user)
 	return c.String(http.StatusOK, "Logged in successfully")
 }
 
 type signUpRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=64"`
+	Email       string `form:"email" json:"email" validate:"required,email"`
+	Password    string `form:"password" json:"password" validate:"required,min=8,max=64"`
+	InviteToken string `form:"invite_token" json:"inviteToken"`
+}
+
+// GetSignUpPage renders the sign-up form, which the invite emails link to with the invite token in the `invite` query param.
+func (h *handler) GetSignUpPage(c echo.Context) error {
+	return c.Render(http.StatusOK, "sign-up.tmpl", echo.Map{"InviteToken": c.QueryParam("invite"), "CSRF": csrfToken(c)})
 }
 
 func (h *handler) SignUp(c echo.Context) error {
@@ -86,6 +176,12 @@ func (h *handler) SignUp(c echo.Context) error {
 	if err := bindAndValidate(c, req); err != nil {
 		return err
 	}
+	if h.config.SignUpMode == config.SignUpClosed {
+		return c.String(http.StatusForbidden, ErrSignUpClosed.Error())
+	}
+	if h.config.SignUpMode == config.SignUpInviteOnly && req.InviteToken == "" {
+		return c.String(http.StatusForbidden, ErrInviteRequired.Error())
+	}
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
 	if err != nil {
 		return err
@@ -94,17 +190,87 @@ func (h *handler) SignUp(c echo.Context) error {
 		Email:        sanitizeEmail(req.Email),
 		PasswordHash: string(passwordHash),
 	}
-	userId, err := h.repo.CreateUser(c.Request().Context(), user)
+	var userId string
+	var auditMetadata map[string]any
+	if h.config.SignUpMode == config.SignUpInviteOnly {
+		// Consume the invite and create the user atomically, so that a failed sign up does not use up the invite.
+		err = h.repo.WithTx(c.Request().Context(), func(tx *repo.Repo) error {
+			invite, err := tx.ConsumeInvite(c.Request().Context(), hashToken(req.InviteToken), user.Email)
+			if err != nil {
+				return err
+			}
+			user.Role = invite.Role
+			auditMetadata = map[string]any{"inviteId": invite.Id}
+			if userId, err = tx.CreateUser(c.Request().Context(), user); err != nil {
+				return err
+			}
+			_, err = tx.CreateOutboxEvent(c.Request().Context(), repo.EventUserCreated, userCreatedEvent(userId, user))
+			return err
+		})
+		if errors.Is(err, repo.ErrInviteInvalid) {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+	} else {
+		err = h.withOutbox(c.Request().Context(), func(users repo.UserRepo, publish publishFunc) error {
+			if userId, err = users.CreateUser(c.Request().Context(), user); err != nil {
+				return err
+			}
+			return publish(repo.EventUserCreated, userCreatedEvent(userId, user))
+		})
+	}
 	if err != nil {
-		fmt.Println(err)
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.String(repoErrorStatus(err), err.Error())
 	}
-	if _, err := createSession(c, userId); err != nil {
+	if _, err := h.createSession(c, userId); err != nil {
 		return err
 	}
+	h.audit(c, repo.AuditSignUp, userId, auditMetadata)
+	h.rememberDevice(c, userId, deviceId(c))
 	return c.String(http.StatusCreated, "Signed up successfully")
 }
 
+type reauthenticateRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// @Summary Reauthenticate
+// @Description Confirm the current user's password to allow sensitive operations for a while.
+// @Security ApiKeyAuth
+// @Router /v1/auth/reauthenticate [post]
+// @Success 200 {string} string "Reauthenticated successfully"
+// @Failure 401 {string} string "invalid session"
+func (h *handler) Reauthenticate(c echo.Context) error {
+	req := new(reauthenticateRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user := c.Get("user").(*repo.User)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.audit(c, repo.AuditReauthFailed, user.Id, nil)
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
+	sess, err := session.Get("session", c)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
+	sess.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   sessionMaxAge,
+		HttpOnly: true,
+	}
+	sess.Values["auth_time"] = time.Now().Unix()
+	// The session is extended along with its cookie.
+	sessionId, _ := sess.Values["session_id"].(string)
+	if err = h.sessions().Expire(c.Request().Context(), sessionKey(user.Id, sessionId), sessionMaxAge*time.Second); err != nil {
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
+	if err = sess.Save(c.Request(), c.Response()); err != nil {
+		return err
+	}
+	h.audit(c, repo.AuditReauthenticated, user.Id, nil)
+	return c.String(http.StatusOK, "Reauthenticated successfully")
+}
+
 type changePasswordRequest struct {
 	CurrentPassword string `json:"currentPassword" validate:"required,min=8,max=64"`
 	NewPassword     string `json:"newPassword" validate:"required,min=8,max=64"`
@@ -115,27 +281,83 @@ func (h *handler) ChangePassword(c echo.Context) error {
 	if err := bindAndValidate(c, req); err != nil {
 		return err
 	}
-	sess, err := session.Get("session", c)
+	userId, err := h.sessionUserId(c)
 	if err != nil {
-		return c.String(http.StatusUnauthorized, ErrUserNotLoggedIn.Error())
-	}
-	userId, ok := sess.Values["user_id"].(string)
-	if !ok {
-		return c.String(http.StatusUnauthorized, ErrUserNotLoggedIn.Error())
+		return c.String(http.StatusUnauthorized, err.Error())
 	}
-	user, err := h.repo.GetUserById(c.Request().Context(), userId)
+	user, err := h.users.GetUserById(c.Request().Context(), userId)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
+	c.Set("user", user)
 	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
 		return c.String(http.StatusUnauthorized, err.Error())
 	}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 12)
-	err = h.repo.Update(c.Request().Context(), userId, map[string]any{
-		"password_hash": string(hash),
+	if err = h.changePasswordHash(c.Request().Context(), userId, string(hash), "changed"); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditPasswordChanged, userId, nil)
+	return c.String(http.StatusOK, "Password changed successfully")
+}
+
+// changePasswordHash updates the password hash of the user and publishes EventUserPasswordChanged. `reason` is either "changed" or "reset".
+func (h *handler) changePasswordHash(ctx context.Context, userId string, hash string, reason string) error {
+	return h.withOutbox(ctx, func(users repo.UserRepo, publish publishFunc) error {
+		if err := users.Update(ctx, userId, map[string]any{"password_hash": hash}); err != nil {
+			return err
+		}
+		return publish(repo.EventUserPasswordChanged, map[string]any{"user_id": userId, "reason": reason})
 	})
+}
+
+func userCreatedEvent(userId string, user *repo.UserCore) map[string]any {
+	return map[string]any{"user_id": userId, "email": user.Email}
+}
+
+// startPasswordReset emails the user a single-use link to reset their password.
+func (h *handler) startPasswordReset(c echo.Context, user *repo.User) error {
+	token := cryptoutil.RandomString()
+	if err := h.kvStore.Set(c.Request().Context(), passwordResetKeyPrefix+hashToken(token), user.Id, passwordResetExpiry); err != nil {
+		return err
+	}
+	resetUrl := url.URL{Scheme: c.Scheme(), Host: c.Request().Host, Path: "/v1/auth/reset-password", RawQuery: url.Values{"token": {token}}.Encode()}
+	return h.sendEmail(c, user.Email, "Reset your password", "password-reset.tmpl", echo.Map{"URL": resetUrl.String()})
+}
+
+type resetPasswordRequest struct {
+	Token       string `form:"token" json:"token" validate:"required"`
+	NewPassword string `form:"new_password" json:"newPassword" validate:"required,min=8,max=64"`
+}
+
+func (h *handler) GetResetPasswordPage(c echo.Context) error {
+	return c.Render(http.StatusOK, "change-password.tmpl", echo.Map{"Token": c.QueryParam("token"), "CSRF": csrfToken(c)})
+}
+
+func (h *handler) ResetPassword(c echo.Context) error {
+	req := new(resetPasswordRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	key := passwordResetKeyPrefix + hashToken(req.Token)
+	// Tokens are single use, so they are deleted as they are read.
+	userId, err := h.kvStore.GetDel(c.Request().Context(), key)
 	if err != nil {
+		if errors.Is(err, kvstore.ErrKeyNotFound) {
+			return c.String(http.StatusUnauthorized, ErrInvalidToken.Error())
+		}
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
-	return c.String(http.StatusOK, "Password changed successfully")
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 12)
+	if err != nil {
+		return err
+	}
+	if err = h.changePasswordHash(c.Request().Context(), userId, string(hash), "reset"); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if err = h.revokeSessions(c.Request().Context(), userId); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditPasswordReset, userId, nil)
+	return c.String(http.StatusOK, "Password reset successfully")
 }
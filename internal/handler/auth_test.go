@@ -2,100 +2,96 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"testing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
 )
 
-// func TestAuth(t *testing.T) {
-// 	cfg, err := config.Load("../.env")
-// 	assert.Nil(t, err)
+func TestSignUpPage(t *testing.T) {
+	s := server
+	c := s.newClient(t)
 
-// 	db, err := sql.Open("postgres", cfg.DatabaseUrl)
-// 	assert.Nil(t, err)
-// 	defer db.Close()
+	t.Run("Escape the invite token", func(t *testing.T) {
+		res := c.get("/v1/auth/sign-up?invite=" + url.QueryEscape(`"><script>`))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Contains(t, res.Body.String(), `name="invite_token" value="&#34;&gt;&lt;script&gt;"`)
+	})
 
-// 	h := api.New(&api.HandlerOpts{Repo: repo.New(db)})
-// 	e, err := api.NewRouter(h)
-// 	assert.Nil(t, err)
+	t.Run("Sign up with the form", func(t *testing.T) {
+		res := c.submitForm("/v1/auth/sign-up", map[string]string{"email": "form@test.com", "password": "password123"})
+		assert.Equal(t, http.StatusCreated, res.Code, res.Body.String())
+		assert.Equal(t, "form@test.com", c.me().Email)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	s := server
+	s.signUp(t, "user@test.com", "password123")
+	// The login from a new device emails a link to the not me page.
+	s.logIn(t, "user@test.com", "password123")
+	newDeviceEmail, ok := s.smtp.lastEmail("user@test.com", "New login to your account")
+	if !assert.True(t, ok) {
+		return
+	}
 
-// 	var accessToken string
-// 	var refreshTokenCookie *http.Cookie
-// 	t.Run("Sign up", func(t *testing.T) {
-// 		req, err := createHttpRequest(http.MethodPost, "/v1/auth/sign-up", nil, echo.Map{"email": "user@test.com", "password": "password123", "confirm_password": "password123"}, map[string]string{"Content-Type": "application/json"})
-// 		assert.Nil(t, err)
+	c := s.newClient(t)
+	res := c.submitForm(newDeviceEmail.link(t), nil)
+	assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	resetEmail, ok := s.smtp.lastEmail("user@test.com", "Reset your password")
+	if !assert.True(t, ok) {
+		return
+	}
+	resetLink := resetEmail.link(t)
 
-// 		res := httptest.NewRecorder()
-// 		c := e.NewContext(req, res)
-// 		_ = h.SignUp(c)
-// 		if res.Code != http.StatusCreated {
-// 			t.Error(res.Body.String())
-// 		}
-// 		var data api.LogInResponse
-// 		_ = json.Unmarshal(res.Body.Bytes(), &data)
-// 		accessToken = data.AccessToken
-// 		for _, cookie := range res.Result().Cookies() {
-// 			refreshTokenCookie = cookie
-// 		}
-// 	})
+	t.Run("Reset password with the form", func(t *testing.T) {
+		res := c.submitForm(resetLink, map[string]string{"new_password": "newpassword123"})
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
 
-// 	t.Run("Log in", func(t *testing.T) {
-// 		if accessToken == "" || refreshTokenCookie == nil {
-// 			t.Skip()
-// 		}
-// 		req, err := createHttpRequest(http.MethodPost, "/v1/auth/log-in", nil, echo.Map{"email": "user@test.com", "password": "password123"}, map[string]string{"Content-Type": "application/json"})
-// 		assert.Nil(t, err)
+		s.logIn(t, "user@test.com", "newpassword123")
+		res = s.newClient(t).json(http.MethodPost, "/v1/auth/log-in", echo.Map{"email": "user@test.com", "password": "password123"}, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
 
-// 		res := httptest.NewRecorder()
-// 		c := e.NewContext(req, res)
-// 		_ = h.LogIn(c)
-// 		if res.Code != http.StatusOK {
-// 			t.Error(res.Body.String())
-// 		}
-// 		var data api.LogInResponse
-// 		_ = json.Unmarshal(res.Body.Bytes(), &data)
-// 		accessToken = data.AccessToken
-// 		refreshTokenCookie = nil
-// 		for _, cookie := range res.Result().Cookies() {
-// 			refreshTokenCookie = cookie
-// 		}
-// 	})
+	t.Run("Reject used token", func(t *testing.T) {
+		res := c.submitForm(resetLink, map[string]string{"new_password": "otherpassword123"})
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
 
-// 	t.Run("Log out", func(t *testing.T) {
-// 		if accessToken == "" || refreshTokenCookie == nil {
-// 			t.Skip()
-// 		}
-// 		req, err := createHttpRequest(http.MethodPost, "/v1/auth/log-out", nil, nil, map[string]string{"Authorization": fmt.Sprintf("Bearer %s", accessToken), "Content-Type": "application/json"})
-// 		assert.Nil(t, err)
+	t.Run("Reject form without CSRF token", func(t *testing.T) {
+		values := url.Values{"token": {"token"}, "new_password": {"otherpassword123"}}
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/reset-password", strings.NewReader(values.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		res := s.newClient(t).do(req)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+	})
+}
 
-// 		req.AddCookie(refreshTokenCookie)
-// 		res := httptest.NewRecorder()
-// 		c := e.NewContext(req, res)
-// 		_ = h.LogOut(c)
-// 		if res.Code != http.StatusOK {
-// 			t.Error(res.Body.String())
-// 		}
-// 	})
+func TestLegacySession(t *testing.T) {
+	s := server
+	userId := s.signUp(t, "legacy@test.com", "password123").me().Id
 
-// 	t.Run("Delete account", func(t *testing.T) {
-// 		if accessToken == "" {
-// 			t.Skip()
-// 		}
-// 		req, err := createHttpRequest(http.MethodDelete, "/v1/auth/delete-account", nil, nil, map[string]string{"Authorization": fmt.Sprintf("Bearer %s", accessToken), "Content-Type": "application/json"})
-// 		assert.Nil(t, err)
+	// Session cookies issued before sessions were stored only have the user id.
+	c := s.newClient(t)
+	c.setSession(map[any]any{"user_id": userId})
+	assert.Equal(t, userId, c.me().Id)
+	keys, _, err := s.kv.Namespace("sessions").Scan(context.Background(), userId+":", "", 0)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
 
-// 		res := httptest.NewRecorder()
-// 		authMiddleware := h.Protected(api.RoleUser)
-// 		c := e.NewContext(req, res)
-// 		_ = authMiddleware(h.DeleteAccount)(c)
-// 		if res.Code != http.StatusOK {
-// 			t.Error(res.Body.String())
-// 		}
-// 	})
-// }
+	// The cookie holds the id of the upgraded session, which logging out deletes.
+	res := c.json(http.MethodPost, "/v1/auth/log-out", nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	keys, _, err = s.kv.Namespace("sessions").Scan(context.Background(), userId+":", "", 0)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+}
 
 func createHttpRequest(method, path string, query map[string]string, body echo.Map, headers map[string]string) (*http.Request, error) {
 	url, err := url.Parse(path)
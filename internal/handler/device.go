@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/cryptoutil"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const (
+	deviceCookieName      = "device_id"
+	deviceCookieMaxAge    = 86400 * 365 // 1 year
+	knownDeviceExpiry     = time.Hour * 24 * 90
+	notMeTokenExpiry      = time.Hour * 24 * 7
+	knownDeviceKeyPrefix  = "known_device:"
+	knownIpKeyPrefix      = "known_ip:"
+	notMeTokenKeyPrefix   = "not_me:"
+	unknownUserAgentLabel = "Unknown device"
+)
+
+var (
+	ErrInvalidToken = errors.New("token is invalid or expired")
+)
+
+// deviceId returns the id stored in the device cookie, issuing a new cookie if there is none.
+func deviceId(c echo.Context) string {
+	if cookie, err := c.Cookie(deviceCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	deviceId := id.New(id.Device)
+	c.SetCookie(&http.Cookie{
+		Name:     deviceCookieName,
+		Value:    deviceId,
+		Path:     "/",
+		MaxAge:   deviceCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return deviceId
+}
+
+// rememberDevice marks the device and the current IP as known for the user.
+func (h *handler) rememberDevice(c echo.Context, userId string, deviceId string) {
+	for _, key := range [...]string{knownDeviceKeyPrefix + userId + ":" + deviceId, knownIpKeyPrefix + userId + ":" + c.RealIP()} {
+		if err := h.kvStore.Set(c.Request().Context(), key, "1", knownDeviceExpiry); err != nil {
+			slog.ErrorContext(c.Request().Context(), "remember device", slog.Any("error", err))
+		}
+	}
+}
+
+// checkNewDevice emails the user if they logged in from a device or IP that has not been seen for them before, then remembers both.
+func (h *handler) checkNewDevice(c echo.Context, user *repo.User) {
+	ctx := c.Request().Context()
+	deviceId := deviceId(c)
+	isNew := false
+	for _, key := range [...]string{knownDeviceKeyPrefix + user.Id + ":" + deviceId, knownIpKeyPrefix + user.Id + ":" + c.RealIP()} {
+		if _, err := h.kvStore.Get(ctx, key); err != nil {
+			if !errors.Is(err, kvstore.ErrKeyNotFound) {
+				slog.ErrorContext(ctx, "check known device", slog.Any("error", err))
+				return
+			}
+			isNew = true
+		}
+	}
+	h.rememberDevice(c, user.Id, deviceId)
+	if !isNew {
+		return
+	}
+
+	h.audit(c, repo.AuditNewDeviceLogIn, user.Id, nil)
+
+	token := cryptoutil.RandomString()
+	if err := h.kvStore.Set(ctx, notMeTokenKeyPrefix+hashToken(token), user.Id, notMeTokenExpiry); err != nil {
+		slog.ErrorContext(ctx, "create not me token", slog.Any("error", err))
+		return
+	}
+	notMeUrl := url.URL{Scheme: c.Scheme(), Host: c.Request().Host, Path: "/v1/auth/not-me", RawQuery: url.Values{"token": {token}}.Encode()}
+	err := h.sendEmail(c, user.Email, "New login to your account", "new-device.tmpl", echo.Map{
+		"Time":   time.Now().UTC().Format(time.RFC1123),
+		"Device": describeUserAgent(c.Request().UserAgent()),
+		"IP":     c.RealIP(),
+		"URL":    notMeUrl.String(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "send new device email", slog.Any("error", err))
+	}
+}
+
+// describeUserAgent returns an approximate, human readable description such as "Firefox on Windows" of a user agent.
+func describeUserAgent(ua string) string {
+	var browser, os string
+
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+
+	switch {
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		os = "iOS"
+	case strings.Contains(ua, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	case ua != "":
+		return ua
+	default:
+		return unknownUserAgentLabel
+	}
+}
+
+type notMeRequest struct {
+	Token string `form:"token" json:"token" validate:"required"`
+}
+
+// GetNotMePage renders the confirmation form of NotMe, which the new device login emails link to with the token in the `token` query param. The revocation is not done on GET, as email scanners and link previews follow links.
+func (h *handler) GetNotMePage(c echo.Context) error {
+	return c.Render(http.StatusOK, "not-me.tmpl", echo.Map{"Token": c.QueryParam("token"), "CSRF": csrfToken(c)})
+}
+
+// @Summary Report unrecognized login
+// @Description Revoke all sessions of the user and email a password reset link. The token is sent in the new device login email.
+// @Router /v1/auth/not-me [post]
+// @Success 200 {string} string "All sessions have been revoked"
+// @Failure 401 {string} string "token is invalid or expired"
+func (h *handler) NotMe(c echo.Context) error {
+	req := new(notMeRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	key := notMeTokenKeyPrefix + hashToken(req.Token)
+	// Tokens are single use, so they are deleted as they are read.
+	userId, err := h.kvStore.GetDel(c.Request().Context(), key)
+	if err != nil {
+		if errors.Is(err, kvstore.ErrKeyNotFound) {
+			return c.String(http.StatusUnauthorized, ErrInvalidToken.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	user, err := h.users.GetUserById(c.Request().Context(), userId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if err = h.revokeSessions(c.Request().Context(), user.Id); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditSessionsRevoked, user.Id, map[string]any{"reason": "not me"})
+	if err = h.startPasswordReset(c, user); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.String(http.StatusOK, "All sessions have been revoked. Check your email to reset your password.")
+}
@@ -0,0 +1,57 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeviceEmail(t *testing.T) {
+	s := server
+	s.signUp(t, "device@test.com", "password123")
+
+	t.Run("Do not email logins from a known device", func(t *testing.T) {
+		c := s.logIn(t, "device@test.com", "password123")
+		_, ok := s.smtp.lastEmail("device@test.com", "New login to your account")
+		assert.True(t, ok)
+
+		res := c.json(http.MethodPost, "/v1/auth/log-in", echo.Map{"email": "device@test.com", "password": "password123"}, nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, 1, s.smtp.count("device@test.com"))
+	})
+
+	t.Run("Escape the user agent", func(t *testing.T) {
+		c := s.newClient(t)
+		res := c.json(http.MethodPost, "/v1/auth/log-in", echo.Map{"email": "device@test.com", "password": "password123"}, map[string]string{"User-Agent": `<a href="https://evil.test">Click</a>`})
+		assert.Equal(t, http.StatusOK, res.Code)
+		e, ok := s.smtp.lastEmail("device@test.com", "New login to your account")
+		if assert.True(t, ok) {
+			assert.Contains(t, e.body, "&lt;a href=&#34;https://evil.test&#34;&gt;Click&lt;/a&gt;")
+			assert.NotContains(t, e.body, `<a href="https://evil.test">`)
+		}
+	})
+
+	t.Run("Revoke sessions from the not me page", func(t *testing.T) {
+		loggedIn := s.logIn(t, "device@test.com", "password123")
+		assert.Equal(t, http.StatusOK, loggedIn.get("/v1/me").Code)
+		e, ok := s.smtp.lastEmail("device@test.com", "New login to your account")
+		if !assert.True(t, ok) {
+			return
+		}
+		link := e.link(t)
+
+		// Opening the link does not revoke the sessions, as email scanners follow links.
+		c := s.newClient(t)
+		assert.Equal(t, http.StatusOK, c.get(link).Code)
+		assert.Equal(t, http.StatusOK, loggedIn.get("/v1/me").Code)
+
+		res := c.submitForm(link, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, loggedIn.get("/v1/me").Code)
+
+		res = c.submitForm(link, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+}
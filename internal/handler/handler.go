@@ -1,26 +1,37 @@
 package handler
 
 import (
-	"embed"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io/fs"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/rohitxdev/go-api-starter/internal/config"
 	"github.com/rohitxdev/go-api-starter/pkg/blobstore"
 	"github.com/rohitxdev/go-api-starter/pkg/email"
+	"github.com/rohitxdev/go-api-starter/pkg/jobs"
 	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
 	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/rohitxdev/go-api-starter/pkg/scheduler"
 )
 
 type handlerOpts struct {
 	config     *config.Server
-	kvStore    *kvstore.KVStore
+	kvStore    kvstore.Store
 	repo       *repo.Repo
+	users      repo.UserRepo
 	email      *email.Client
 	blobstore  *blobstore.Store
-	fileSystem *embed.FS
+	fileSystem fs.FS
+	jobs       *jobs.Pool
+	scheduler  *scheduler.Scheduler
 }
 
 func WithConfig(config *config.Server) func(*handlerOpts) {
@@ -29,18 +40,26 @@ func WithConfig(config *config.Server) func(*handlerOpts) {
 	}
 }
 
-func WithKVStore(kvStore *kvstore.KVStore) func(*handlerOpts) {
+func WithKVStore(kvStore kvstore.Store) func(*handlerOpts) {
 	return func(ho *handlerOpts) {
 		ho.kvStore = kvStore
 	}
 }
 
+// WithRepo sets the postgres repo, which also backs the user queries unless WithUserRepo is used.
 func WithRepo(repo *repo.Repo) func(*handlerOpts) {
 	return func(ho *handlerOpts) {
 		ho.repo = repo
 	}
 }
 
+// WithUserRepo sets the store of the user queries. Without a postgres repo, features that need it, such as invites, organizations and the audit log, are disabled.
+func WithUserRepo(users repo.UserRepo) func(*handlerOpts) {
+	return func(ho *handlerOpts) {
+		ho.users = users
+	}
+}
+
 func WithEmail(email *email.Client) func(*handlerOpts) {
 	return func(ho *handlerOpts) {
 		ho.email = email
@@ -53,7 +72,22 @@ func WithBlobStore(fs *blobstore.Store) func(*handlerOpts) {
 	}
 }
 
-func WithFileSystem(fileSystem *embed.FS) func(*handlerOpts) {
+// WithJobs registers the handlers of the handler's jobs, such as sending emails, on the pool. It needs a postgres repo to enqueue them; without one, the work is done inline.
+func WithJobs(pool *jobs.Pool) func(*handlerOpts) {
+	return func(ho *handlerOpts) {
+		ho.jobs = pool
+	}
+}
+
+// WithScheduler exposes the status of the scheduler to admins.
+func WithScheduler(s *scheduler.Scheduler) func(*handlerOpts) {
+	return func(ho *handlerOpts) {
+		ho.scheduler = s
+	}
+}
+
+// WithFileSystem sets the file system of the templates and static files, which are read from its "web" directory.
+func WithFileSystem(fileSystem fs.FS) func(*handlerOpts) {
 	return func(ho *handlerOpts) {
 		ho.fileSystem = fileSystem
 	}
@@ -75,9 +109,15 @@ func NewHandler(optFuncs ...func(*handlerOpts)) (*handler, error) {
 	if opts.kvStore == nil {
 		errList = append(errList, errors.New("kvStore is nil"))
 	}
-	if opts.repo == nil {
+	if opts.users == nil && opts.repo != nil {
+		opts.users = opts.repo
+	}
+	if opts.users == nil {
 		errList = append(errList, errors.New("repo is nil"))
 	}
+	if opts.repo == nil && opts.config != nil && opts.config.SignUpMode == config.SignUpInviteOnly {
+		errList = append(errList, errors.New("invite-only sign up requires a postgres repo"))
+	}
 	if opts.email == nil {
 		errList = append(errList, errors.New("email is nil"))
 	}
@@ -92,13 +132,22 @@ func NewHandler(optFuncs ...func(*handlerOpts)) (*handler, error) {
 		return nil, errors.Join(errList...)
 	}
 
+	if opts.jobs != nil {
+		jobs.Handle(opts.jobs, sendEmailJob, func(ctx context.Context, e email.Email) error {
+			return opts.email.SendEmail(&e)
+		})
+	}
+
 	return &handler{
 		config:     opts.config,
 		kvStore:    opts.kvStore,
 		repo:       opts.repo,
+		users:      opts.users,
 		email:      opts.email,
 		blobstore:  opts.blobstore,
 		fileSystem: opts.fileSystem,
+		jobs:       opts.jobs,
+		scheduler:  opts.scheduler,
 	}, nil
 }
 
@@ -133,6 +182,72 @@ func sanitizeEmail(email string) string {
 	return username + "@" + domain
 }
 
+// hashToken returns the hex encoded SHA-256 hash of a random token, so that only the hash needs to be stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseExpiresIn parses a positive duration string such as "72h", returning `fallback` if `s` is empty.
+func parseExpiresIn(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New("invalid expiry duration")
+	}
+	return d, nil
+}
+
+var sendEmailJob = jobs.NewKind[email.Email]("email.send")
+
+// sendEmail renders the email template `name` with `data` and sends it as HTML to `to`. With a job pool, it is sent by a job, so that the request does not wait for the SMTP server and failures are retried.
+func (h *handler) sendEmail(c echo.Context, to string, subject string, name string, data any) error {
+	var body bytes.Buffer
+	if err := c.Echo().Renderer.Render(&body, name, data, c); err != nil {
+		return err
+	}
+	e := &email.Email{
+		Subject:     subject,
+		ContentType: "text/html",
+		Body:        body.String(),
+		FromAddress: h.config.SmtpUsername,
+		ToAddresses: []string{to},
+	}
+	if h.jobs != nil && h.repo != nil {
+		_, err := sendEmailJob.Enqueue(c.Request().Context(), h.repo, *e)
+		return err
+	}
+	return h.email.SendEmail(e)
+}
+
+// repoErrorStatus returns the HTTP status code for an error returned by the repo.
+func repoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repo.ErrUserAlreadyExists), errors.Is(err, repo.ErrUniqueViolation), errors.Is(err, repo.ErrVersionConflict):
+		return http.StatusConflict
+	case errors.Is(err, repo.ErrForeignKeyViolation), errors.Is(err, repo.ErrCheckViolation), errors.Is(err, repo.ErrNotNullViolation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repo.ErrSerializationFailure), errors.Is(err, repo.ErrDeadlock):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, repo.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, repo.ErrUserNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// csrfFormField is the form field the pages send the CSRF token in.
+const csrfFormField = "_csrf"
+
+// csrfToken returns the CSRF token of the request, to be rendered in the `_csrf` field of forms.
+func csrfToken(c echo.Context) string {
+	token, _ := c.Get(middleware.DefaultCSRFConfig.ContextKey).(string)
+	return token
+}
+
 func accepts(c echo.Context) string {
 	acceptedTypes := strings.Split(c.Request().Header.Get("Accept"), ",")
 	return acceptedTypes[0]
@@ -0,0 +1,391 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/internal/handler"
+	"github.com/rohitxdev/go-api-starter/pkg/blobstore"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/email"
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpStandIn is a server speaking enough SMTP to receive the emails of the handlers, so that they can be tested without a mail server.
+type smtpStandIn struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	emails []sentEmail
+}
+
+type sentEmail struct {
+	to      []string
+	subject string
+	body    string
+}
+
+func newSMTPStandIn() (*smtpStandIn, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &smtpStandIn{ln: ln}
+	go s.serve()
+	return s, nil
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) bool {
+		_, err := io.WriteString(conn, line+"\r\n")
+		return err == nil
+	}
+	if !reply("220 localhost ESMTP") {
+		return
+	}
+	var to []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			to = nil
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			to = append(to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			if err = s.receive(to, data.String()); err != nil {
+				reply("554 " + err.Error())
+				continue
+			}
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpStandIn) receive(to []string, data string) error {
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		return err
+	}
+	body := msg.Body
+	if msg.Header.Get("Content-Transfer-Encoding") == "quoted-printable" {
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emails = append(s.emails, sentEmail{to: to, subject: msg.Header.Get("Subject"), body: string(b)})
+	return nil
+}
+
+// lastEmail returns the last email sent to `to` with `subject`.
+func (s *smtpStandIn) lastEmail(to string, subject string) (sentEmail, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.emails) - 1; i >= 0; i-- {
+		if e := s.emails[i]; e.subject == subject && len(e.to) == 1 && e.to[0] == to {
+			return e, true
+		}
+	}
+	return sentEmail{}, false
+}
+
+// count returns the number of emails sent to `to`.
+func (s *smtpStandIn) count(to string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, e := range s.emails {
+		if len(e.to) == 1 && e.to[0] == to {
+			n++
+		}
+	}
+	return n
+}
+
+// linkPattern matches the link of an email.
+var linkPattern = regexp.MustCompile(`href="([^"]+)"`)
+
+// link returns the path and query of the link of the email.
+func (e sentEmail) link(t *testing.T) string {
+	m := linkPattern.FindStringSubmatch(e.body)
+	if m == nil {
+		t.Fatalf("no link in email %q", e.body)
+	}
+	u, err := url.Parse(html.UnescapeString(m[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.RequestURI()
+}
+
+type testServer struct {
+	e     *echo.Echo
+	users *repo.SqliteUserRepo
+	kv    kvstore.Store
+	smtp  *smtpStandIn
+}
+
+// server is shared by the tests, as the router registers its metrics globally and can only be created once. Tests use their own users so that they do not interfere.
+var server *testServer
+
+func TestMain(m *testing.M) {
+	var err error
+	server, err = newTestServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	server.users.Close()
+	server.smtp.ln.Close()
+	os.Exit(code)
+}
+
+// newTestServer returns the router of a handler backed by the SQLite user repo and the memory KV store, which sends emails to an SMTP stand-in.
+func newTestServer() (*testServer, error) {
+	db, err := database.NewSqlite(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: opens a new database.
+	db.SetMaxOpenConns(1)
+	m, err := migrate.New(db, repo.SqliteMigrations, migrate.WithDialect(migrate.SQLite))
+	if err != nil {
+		return nil, err
+	}
+	if err = m.Up(context.Background(), 0); err != nil {
+		return nil, err
+	}
+	users := repo.NewSqliteUserRepo(db)
+
+	smtp, err := newSMTPStandIn()
+	if err != nil {
+		return nil, err
+	}
+	smtpHost, smtpPort, _ := net.SplitHostPort(smtp.ln.Addr().String())
+	port, _ := strconv.Atoi(smtpPort)
+
+	blobStore, err := blobstore.New("http://127.0.0.1", "auto", "key", "secret")
+	if err != nil {
+		return nil, err
+	}
+	kv := kvstore.NewMemory()
+	h, err := handler.NewHandler(
+		handler.WithConfig(&config.Server{
+			Client:         &config.Client{Env: config.EnvDevelopment},
+			Host:           "127.0.0.1",
+			Port:           "8080",
+			SessionSecret:  testSessionSecret,
+			SmtpUsername:   "noreply@test.com",
+			SignUpMode:     config.SignUpOpen,
+			AllowedOrigins: []string{"*"},
+		}),
+		handler.WithKVStore(kv),
+		handler.WithUserRepo(users),
+		handler.WithEmail(email.New(smtpHost, port, "", "")),
+		handler.WithBlobStore(blobStore),
+		handler.WithFileSystem(os.DirFS("../..")),
+	)
+	if err != nil {
+		return nil, err
+	}
+	e, err := handler.New(h)
+	if err != nil {
+		return nil, err
+	}
+	return &testServer{e: e, users: users, kv: kv, smtp: smtp}, nil
+}
+
+const testSessionSecret = "secret"
+
+// testClient sends requests to the test server like a browser, keeping the cookies it is sent.
+type testClient struct {
+	t       *testing.T
+	e       *echo.Echo
+	cookies map[string]*http.Cookie
+}
+
+func (s *testServer) newClient(t *testing.T) *testClient {
+	return &testClient{t: t, e: s.e, cookies: map[string]*http.Cookie{}}
+}
+
+func (c *testClient) do(req *http.Request) *httptest.ResponseRecorder {
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	res := httptest.NewRecorder()
+	c.e.ServeHTTP(res, req)
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(c.cookies, cookie.Name)
+		} else {
+			c.cookies[cookie.Name] = cookie
+		}
+	}
+	return res
+}
+
+func (c *testClient) get(path string) *httptest.ResponseRecorder {
+	return c.do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// json sends `body` as JSON, with the CSRF token in its header as API clients do.
+func (c *testClient) json(method string, path string, body echo.Map, headers map[string]string) *httptest.ResponseRecorder {
+	if c.cookies["_csrf"] == nil {
+		c.get("/ping")
+	}
+	h := map[string]string{echo.HeaderContentType: echo.MIMEApplicationJSON, echo.HeaderXCSRFToken: c.cookies["_csrf"].Value}
+	for key, value := range headers {
+		h[key] = value
+	}
+	req, err := createHttpRequest(method, path, nil, body, h)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.do(req)
+}
+
+var (
+	formPattern        = regexp.MustCompile(`<form method="post" action="([^"]+)">`)
+	hiddenInputPattern = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]*)">`)
+)
+
+// submitForm opens the page at `path` and posts its form with its hidden fields and `fields`, as a browser does.
+func (c *testClient) submitForm(path string, fields map[string]string) *httptest.ResponseRecorder {
+	page := c.get(path)
+	if page.Code != http.StatusOK {
+		c.t.Fatalf("could not get page %s: %d %s", path, page.Code, page.Body.String())
+	}
+	form := formPattern.FindStringSubmatch(page.Body.String())
+	if form == nil {
+		c.t.Fatalf("no form in page %s", path)
+	}
+	values := url.Values{}
+	for _, m := range hiddenInputPattern.FindAllStringSubmatch(page.Body.String(), -1) {
+		values.Set(m[1], html.UnescapeString(m[2]))
+	}
+	for key, value := range fields {
+		values.Set(key, value)
+	}
+	req := httptest.NewRequest(http.MethodPost, form[1], strings.NewReader(values.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	return c.do(req)
+}
+
+// signUp signs up a user on a new client, which is logged in as the user.
+func (s *testServer) signUp(t *testing.T, email string, password string) *testClient {
+	c := s.newClient(t)
+	res := c.json(http.MethodPost, "/v1/auth/sign-up", echo.Map{"email": email, "password": password}, nil)
+	assert.Equal(t, http.StatusCreated, res.Code, res.Body.String())
+	return c
+}
+
+// logIn logs in on a new client.
+func (s *testServer) logIn(t *testing.T, email string, password string) *testClient {
+	c := s.newClient(t)
+	res := c.json(http.MethodPost, "/v1/auth/log-in", echo.Map{"email": email, "password": password}, nil)
+	assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	return c
+}
+
+// me returns the logged in user.
+func (c *testClient) me() *repo.User {
+	res := c.get("/v1/me")
+	if res.Code != http.StatusOK {
+		c.t.Fatalf("could not get user: %d %s", res.Code, res.Body.String())
+	}
+	user := new(repo.User)
+	if err := json.Unmarshal(res.Body.Bytes(), user); err != nil {
+		c.t.Fatal(err)
+	}
+	return user
+}
+
+// setSession sets a session cookie with `values`, signed like the server's.
+func (c *testClient) setSession(values map[any]any) {
+	store := sessions.NewCookieStore([]byte(testSessionSecret))
+	sess := sessions.NewSession(store, "session")
+	sess.Values = values
+	res := httptest.NewRecorder()
+	if err := store.Save(httptest.NewRequest(http.MethodGet, "/", nil), res, sess); err != nil {
+		c.t.Fatal(err)
+	}
+	for _, cookie := range res.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+}
+
+// session returns the values of the session cookie.
+func (c *testClient) session() map[any]any {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie := c.cookies["session"]; cookie != nil {
+		req.AddCookie(cookie)
+	}
+	sess, err := sessions.NewCookieStore([]byte(testSessionSecret)).Get(req, "session")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return sess.Values
+}
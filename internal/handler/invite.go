@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/cryptoutil"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const (
+	defaultInviteExpiry = time.Hour * 72
+)
+
+type createInviteRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	Role      string `json:"role" validate:"omitempty,oneof=user admin"`
+	ExpiresIn string `json:"expiresIn"`
+}
+
+// @Summary Create invite
+// @Description Create a sign-up invite and email it to the invitee. Requires recent authentication.
+// @Security ApiKeyAuth
+// @Router /v1/admin/invites [post]
+// @Success 201 {object} repo.Invite
+// @Failure 401 {object} reauthenticationRequiredResponse
+func (h *handler) CreateInvite(c echo.Context) error {
+	req := new(createInviteRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	expiresIn, err := parseExpiresIn(req.ExpiresIn, defaultInviteExpiry)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, err.Error())
+	}
+	admin := c.Get("user").(*repo.User)
+	invite := &repo.Invite{
+		Email:     sanitizeEmail(req.Email),
+		Role:      req.Role,
+		InvitedBy: admin.Id,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	token := cryptoutil.RandomString()
+	inviteId, err := h.repo.CreateInvite(c.Request().Context(), invite, hashToken(token))
+	if err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	invite.Id = inviteId
+	if invite.Role == "" {
+		invite.Role = "user"
+	}
+
+	inviteUrl := url.URL{Scheme: c.Scheme(), Host: c.Request().Host, Path: "/v1/auth/sign-up", RawQuery: url.Values{"invite": {token}}.Encode()}
+	err = h.sendEmail(c, req.Email, "You have been invited", "invite.tmpl", echo.Map{"URL": inviteUrl.String(), "ExpiresAt": invite.ExpiresAt.Format(time.RFC1123)})
+	if err != nil {
+		_ = h.repo.DeleteInviteById(c.Request().Context(), inviteId)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditInviteCreated, inviteId, map[string]any{"email": invite.Email, "role": invite.Role})
+	return c.JSON(http.StatusCreated, invite)
+}
+
+type deleteInviteRequest struct {
+	InviteId string `param:"invite_id" validate:"required"`
+}
+
+// @Summary Revoke invite
+// @Description Revoke a sign-up invite.
+// @Security ApiKeyAuth
+// @Router /v1/admin/invites/{invite_id} [delete]
+// @Success 200 {string} string "Invite revoked"
+// @Failure 404 {string} string "invite not found"
+func (h *handler) DeleteInvite(c echo.Context) error {
+	req := new(deleteInviteRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	if err := h.repo.DeleteInviteById(c.Request().Context(), req.InviteId); err != nil {
+		if errors.Is(err, repo.ErrInviteNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditInviteRevoked, req.InviteId, nil)
+	return c.String(http.StatusOK, "Invite revoked")
+}
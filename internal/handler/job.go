@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+type jobsResponse struct {
+	Jobs       []repo.Job `json:"jobs"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+type getJobsRequest struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending running succeeded failed"`
+	Kind   string `query:"kind"`
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,gte=1,lte=200"`
+}
+
+// @Summary Get jobs
+// @Description Get background jobs, newest first. Filter by status and kind, and paginate using the returned cursor.
+// @Security ApiKeyAuth
+// @Router /v1/admin/jobs [get]
+// @Success 200 {object} jobsResponse
+// @Failure 401 {string} string "invalid session"
+func (h *handler) GetJobs(c echo.Context) error {
+	req := new(getJobsRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	jobs, nextCursor, err := h.repo.GetJobs(c.Request().Context(), &repo.JobFilter{
+		Status: req.Status,
+		Kind:   req.Kind,
+		Cursor: req.Cursor,
+		Limit:  req.Limit,
+	})
+	if err != nil {
+		if errors.Is(err, repo.ErrInvalidCursor) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, jobsResponse{Jobs: jobs, NextCursor: nextCursor})
+}
+
+type retryJobRequest struct {
+	JobId string `param:"job_id" validate:"required"`
+}
+
+// @Summary Retry job
+// @Description Run a failed job again as soon as possible, with its attempts reset.
+// @Security ApiKeyAuth
+// @Router /v1/admin/jobs/{job_id}/retry [post]
+// @Success 200 {object} repo.Job
+// @Failure 401 {string} string "invalid session"
+// @Failure 404 {string} string "job not found"
+// @Failure 409 {string} string "job with the same unique key is already queued"
+func (h *handler) RetryJob(c echo.Context) error {
+	req := new(retryJobRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	if err := h.repo.RequeueJob(c.Request().Context(), req.JobId); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrJobNotFound):
+			return c.String(http.StatusNotFound, err.Error())
+		case errors.Is(err, repo.ErrJobAlreadyQueued):
+			return c.String(http.StatusConflict, err.Error())
+		}
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	job, err := h.repo.GetJobById(c.Request().Context(), req.JobId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, job)
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
 )
 
 type role uint8
@@ -24,15 +27,11 @@ var roleMap = map[string]role{
 func (h *handler) protected(role role) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			sess, err := session.Get("session", c)
+			userId, err := h.sessionUserId(c)
 			if err != nil {
-				return c.String(http.StatusUnauthorized, err.Error())
-			}
-			userId, ok := sess.Values["user_id"].(string)
-			if !ok {
 				return c.String(http.StatusUnauthorized, "invalid session")
 			}
-			user, err := h.repo.GetUserById(c.Request().Context(), userId)
+			user, err := h.users.GetUserById(c.Request().Context(), userId)
 			if err != nil {
 				return c.String(http.StatusUnauthorized, err.Error())
 			}
@@ -44,3 +43,96 @@ func (h *handler) protected(role role) echo.MiddlewareFunc {
 		}
 	}
 }
+
+const (
+	recentAuthMaxAge = time.Minute * 10
+)
+
+const (
+	ErrCodeReauthenticationRequired = "reauthentication_required"
+)
+
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type reauthenticationRequiredResponse struct {
+	errorResponse
+	MaxAgeSeconds int `json:"maxAgeSeconds"`
+}
+
+// requireRecentAuth rejects requests whose session has not proven the user's credentials within `maxAge`, either by logging in or by reauthenticating. It must run after `protected`.
+func (h *handler) requireRecentAuth(maxAge time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sess, err := session.Get("session", c)
+			if err != nil {
+				return c.String(http.StatusUnauthorized, "invalid session")
+			}
+			authTime, _ := sess.Values["auth_time"].(int64)
+			if time.Since(time.Unix(authTime, 0)) > maxAge {
+				return c.JSON(http.StatusUnauthorized, reauthenticationRequiredResponse{
+					errorResponse: errorResponse{
+						Code:    ErrCodeReauthenticationRequired,
+						Message: "recent authentication is required, reauthenticate and retry",
+					},
+					MaxAgeSeconds: int(maxAge.Seconds()),
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+type orgRole uint8
+
+const (
+	OrgRoleMember orgRole = iota + 1
+	OrgRoleAdmin
+	OrgRoleOwner
+)
+
+var orgRoleMap = map[string]orgRole{
+	"member": OrgRoleMember,
+	"admin":  OrgRoleAdmin,
+	"owner":  OrgRoleOwner,
+}
+
+const orgIdHeader = "X-Org-Id"
+
+// tenant resolves the organization from the `org_id` path param or the X-Org-Id header and checks that the user has at least `role` in it. It must run after `protected`. The organization and membership are available to handlers as `org` and `membership`.
+func (h *handler) tenant(role orgRole) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, ok := c.Get("user").(*repo.User)
+			if !ok {
+				return c.String(http.StatusUnauthorized, "invalid session")
+			}
+			orgId := c.Param("org_id")
+			if orgId == "" {
+				orgId = c.Request().Header.Get(orgIdHeader)
+			}
+			if orgId == "" {
+				return c.String(http.StatusBadRequest, "organization is not specified")
+			}
+			membership, err := h.repo.GetMembership(c.Request().Context(), orgId, user.Id)
+			if err != nil {
+				if errors.Is(err, repo.ErrMembershipNotFound) {
+					return c.String(http.StatusNotFound, repo.ErrOrganizationNotFound.Error())
+				}
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+			if orgRoleMap[membership.Role] < role {
+				return c.String(http.StatusForbidden, "forbidden")
+			}
+			org, err := h.repo.GetOrganizationById(c.Request().Context(), orgId)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, err.Error())
+			}
+			c.Set("org", org)
+			c.Set("membership", membership)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/cryptoutil"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const (
+	defaultOrgInvitationExpiry = time.Hour * 24 * 7
+)
+
+var (
+	ErrOwnerMembership = errors.New("owner membership cannot be changed")
+)
+
+type createOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+	Slug string `json:"slug" validate:"required,alphanum,max=32"`
+}
+
+// @Summary Create organization
+// @Description Create an organization owned by the current user.
+// @Security ApiKeyAuth
+// @Router /v1/orgs [post]
+// @Success 201 {object} repo.Organization
+// @Failure 401 {string} string "invalid session"
+// @Failure 409 {string} string "slug is taken"
+func (h *handler) CreateOrganization(c echo.Context) error {
+	req := new(createOrganizationRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user := c.Get("user").(*repo.User)
+	orgId, err := h.repo.CreateOrganization(c.Request().Context(), &repo.Organization{Name: req.Name, Slug: req.Slug}, user.Id)
+	if err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	org, err := h.repo.GetOrganizationById(c.Request().Context(), orgId)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditOrgCreated, org.Id, nil)
+	return c.JSON(http.StatusCreated, org)
+}
+
+// @Summary Get organizations
+// @Description Get the organizations the current user is a member of.
+// @Security ApiKeyAuth
+// @Router /v1/orgs [get]
+// @Success 200 {array} repo.Organization
+// @Failure 401 {string} string "invalid session"
+func (h *handler) GetOrganizations(c echo.Context) error {
+	user := c.Get("user").(*repo.User)
+	orgs, err := h.repo.GetOrganizationsByUserId(c.Request().Context(), user.Id)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, orgs)
+}
+
+// @Summary Get organization
+// @Description Get an organization the current user is a member of.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/{org_id} [get]
+// @Success 200 {object} repo.Organization
+// @Failure 404 {string} string "organization not found"
+func (h *handler) GetOrganization(c echo.Context) error {
+	return c.JSON(http.StatusOK, c.Get("org"))
+}
+
+// @Summary Get organization members
+// @Description Get the memberships of an organization.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/{org_id}/members [get]
+// @Success 200 {array} repo.Membership
+// @Failure 404 {string} string "organization not found"
+func (h *handler) GetOrganizationMembers(c echo.Context) error {
+	org := c.Get("org").(*repo.Organization)
+	memberships, err := h.repo.GetMembershipsByOrgId(c.Request().Context(), org.Id)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, memberships)
+}
+
+type updateOrganizationMemberRequest struct {
+	UserId string `param:"user_id" validate:"required"`
+	Role   string `json:"role" validate:"required,oneof=member admin"`
+}
+
+// @Summary Update organization member
+// @Description Change the role of an organization member.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/{org_id}/members/{user_id} [patch]
+// @Success 200 {string} string "Member updated"
+// @Failure 403 {string} string "forbidden"
+func (h *handler) UpdateOrganizationMember(c echo.Context) error {
+	req := new(updateOrganizationMemberRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	org := c.Get("org").(*repo.Organization)
+	target, err := h.repo.GetMembership(c.Request().Context(), org.Id, req.UserId)
+	if err != nil {
+		if errors.Is(err, repo.ErrMembershipNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if orgRoleMap[target.Role] == OrgRoleOwner {
+		return c.String(http.StatusForbidden, ErrOwnerMembership.Error())
+	}
+	if err = h.repo.UpdateMembershipRole(c.Request().Context(), org.Id, req.UserId, req.Role); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditOrgMemberUpdated, req.UserId, map[string]any{"orgId": org.Id, "role": req.Role})
+	return c.String(http.StatusOK, "Member updated")
+}
+
+type deleteOrganizationMemberRequest struct {
+	UserId string `param:"user_id" validate:"required"`
+}
+
+// @Summary Remove organization member
+// @Description Remove a member from an organization. Members can remove themselves, admins can remove anyone but the owner.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/{org_id}/members/{user_id} [delete]
+// @Success 200 {string} string "Member removed"
+// @Failure 403 {string} string "forbidden"
+func (h *handler) DeleteOrganizationMember(c echo.Context) error {
+	req := new(deleteOrganizationMemberRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	org := c.Get("org").(*repo.Organization)
+	membership := c.Get("membership").(*repo.Membership)
+	if req.UserId != membership.UserId && orgRoleMap[membership.Role] < OrgRoleAdmin {
+		return c.String(http.StatusForbidden, "forbidden")
+	}
+	target, err := h.repo.GetMembership(c.Request().Context(), org.Id, req.UserId)
+	if err != nil {
+		if errors.Is(err, repo.ErrMembershipNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if orgRoleMap[target.Role] == OrgRoleOwner {
+		return c.String(http.StatusForbidden, ErrOwnerMembership.Error())
+	}
+	if err = h.repo.DeleteMembership(c.Request().Context(), org.Id, req.UserId); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditOrgMemberRemoved, req.UserId, map[string]any{"orgId": org.Id})
+	return c.String(http.StatusOK, "Member removed")
+}
+
+type createOrgInvitationRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	Role      string `json:"role" validate:"omitempty,oneof=member admin"`
+	ExpiresIn string `json:"expiresIn"`
+}
+
+// @Summary Create organization invitation
+// @Description Invite a user by email to join an organization.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/{org_id}/invitations [post]
+// @Success 201 {object} repo.OrgInvitation
+// @Failure 403 {string} string "forbidden"
+func (h *handler) CreateOrgInvitation(c echo.Context) error {
+	req := new(createOrgInvitationRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	expiresIn, err := parseExpiresIn(req.ExpiresIn, defaultOrgInvitationExpiry)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, err.Error())
+	}
+	org := c.Get("org").(*repo.Organization)
+	user := c.Get("user").(*repo.User)
+	invitation := &repo.OrgInvitation{
+		OrgId:     org.Id,
+		Email:     sanitizeEmail(req.Email),
+		Role:      req.Role,
+		InvitedBy: user.Id,
+		ExpiresAt: time.Now().Add(expiresIn),
+	}
+	token := cryptoutil.RandomString()
+	invitationId, err := h.repo.CreateOrgInvitation(c.Request().Context(), invitation, hashToken(token))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	invitation.Id = invitationId
+	if invitation.Role == "" {
+		invitation.Role = "member"
+	}
+
+	invitationUrl := url.URL{Scheme: c.Scheme(), Host: c.Request().Host, Path: "/v1/orgs/invitations/accept", RawQuery: url.Values{"token": {token}}.Encode()}
+	err = h.sendEmail(c, req.Email, "You have been invited to join "+org.Name, "org-invitation.tmpl", echo.Map{"OrgName": org.Name, "URL": invitationUrl.String(), "ExpiresAt": invitation.ExpiresAt.Format(time.RFC1123)})
+	if err != nil {
+		_ = h.repo.DeleteOrgInvitation(c.Request().Context(), org.Id, invitationId)
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditOrgInviteCreated, invitationId, map[string]any{"orgId": org.Id, "email": invitation.Email, "role": invitation.Role})
+	return c.JSON(http.StatusCreated, invitation)
+}
+
+type deleteOrgInvitationRequest struct {
+	InvitationId string `param:"invitation_id" validate:"required"`
+}
+
+// @Summary Revoke organization invitation
+// @Description Revoke an invitation to join an organization.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/{org_id}/invitations/{invitation_id} [delete]
+// @Success 200 {string} string "Invitation revoked"
+// @Failure 404 {string} string "organization invitation not found"
+func (h *handler) DeleteOrgInvitation(c echo.Context) error {
+	req := new(deleteOrgInvitationRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	org := c.Get("org").(*repo.Organization)
+	if err := h.repo.DeleteOrgInvitation(c.Request().Context(), org.Id, req.InvitationId); err != nil {
+		if errors.Is(err, repo.ErrOrgInvitationNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditOrgInviteRevoked, req.InvitationId, map[string]any{"orgId": org.Id})
+	return c.String(http.StatusOK, "Invitation revoked")
+}
+
+type acceptOrgInvitationRequest struct {
+	Token string `form:"token" json:"token" validate:"required"`
+}
+
+// GetAcceptOrgInvitationPage renders the form that accepts an invitation, which the invitation emails link to with the token in the `token` query param. The invitee must be logged in to accept it.
+func (h *handler) GetAcceptOrgInvitationPage(c echo.Context) error {
+	_, err := h.sessionUserId(c)
+	return c.Render(http.StatusOK, "accept-org-invitation.tmpl", echo.Map{"Token": c.QueryParam("token"), "LoggedIn": err == nil, "CSRF": csrfToken(c)})
+}
+
+// @Summary Accept organization invitation
+// @Description Join an organization using an invitation token sent to the current user's email.
+// @Security ApiKeyAuth
+// @Router /v1/orgs/invitations/accept [post]
+// @Success 200 {object} repo.Membership
+// @Failure 403 {string} string "organization invitation is invalid or expired"
+func (h *handler) AcceptOrgInvitation(c echo.Context) error {
+	req := new(acceptOrgInvitationRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user := c.Get("user").(*repo.User)
+	membership, err := h.repo.AcceptOrgInvitation(c.Request().Context(), hashToken(req.Token), user.Id, user.Email)
+	if err != nil {
+		if errors.Is(err, repo.ErrOrgInvitationInvalid) {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditOrgInviteAccepted, user.Id, map[string]any{"orgId": membership.OrgId, "role": membership.Role})
+	return c.JSON(http.StatusOK, membership)
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+// publishFunc adds an event to the outbox in the transaction of withOutbox.
+type publishFunc func(topic string, payload any) error
+
+// withOutbox runs `fn` in a transaction, so that the events it publishes are added to the outbox if and only if its changes are committed. `fn` may run more than once if the transaction is retried. Without a postgres repo, `fn` runs on the user repo and events are dropped.
+func (h *handler) withOutbox(ctx context.Context, fn func(users repo.UserRepo, publish publishFunc) error) error {
+	if h.repo == nil {
+		return fn(h.users, func(string, any) error { return nil })
+	}
+	return h.repo.WithTx(ctx, func(tx *repo.Repo) error {
+		return fn(tx, func(topic string, payload any) error {
+			_, err := tx.CreateOutboxEvent(ctx, topic, payload)
+			return err
+		})
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/rohitxdev/go-api-starter/docs"
+	"github.com/rohitxdev/go-api-starter/internal/common"
 	"github.com/rohitxdev/go-api-starter/internal/config"
 	"github.com/rohitxdev/go-api-starter/pkg/id"
 	"github.com/rohitxdev/go-api-starter/pkg/repo"
@@ -103,7 +104,8 @@ func New(h *handler) (*echo.Echo, error) {
 		echo.TrustPrivateNet(false), // e.g. ipv4 start with 10. or 192.168
 	)
 
-	e.Pre(middleware.CSRF())
+	// The token is also read from the `_csrf` field of the forms of the pages, which cannot set headers.
+	e.Pre(middleware.CSRFWithConfig(middleware.CSRFConfig{TokenLookup: "header:" + echo.HeaderXCSRFToken + ",form:" + csrfFormField}))
 
 	e.Pre(middleware.StaticWithConfig(middleware.StaticConfig{
 		Root:       "web",
@@ -124,6 +126,10 @@ func New(h *handler) (*echo.Echo, error) {
 		Generator: func() string {
 			return id.New(id.Request)
 		},
+		// The request id is added to the context, so that it can be logged by code that only has the context.
+		RequestIDHandler: func(c echo.Context, requestId string) {
+			c.SetRequest(c.Request().WithContext(common.WithRequestId(c.Request().Context(), requestId)))
+		},
 	}))
 
 	if h.config.RateLimitPerMinute > 0 {
@@ -134,6 +140,14 @@ func New(h *handler) (*echo.Echo, error) {
 			})}))
 	}
 
+	// Reads after a write in the same request go to the primary database, so that they see the write.
+	e.Pre(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(repo.ReadYourWrites(c.Request().Context())))
+			return next(c)
+		}
+	})
+
 	e.Use(session.Middleware(sessions.NewCookieStore([]byte(h.config.SessionSecret))))
 
 	// Gzip compression & decompression
@@ -248,10 +262,60 @@ func New(h *handler) (*echo.Echo, error) {
 	{
 		auth := v1.Group("/auth")
 		{
+			auth.GET("/sign-up", h.GetSignUpPage)
 			auth.POST("/sign-up", h.SignUp)
 			auth.POST("/log-in", h.LogIn)
 			auth.POST("/log-out", h.LogOut)
 			auth.POST("/change-password", h.ChangePassword)
+			auth.GET("/reset-password", h.GetResetPasswordPage)
+			auth.POST("/reset-password", h.ResetPassword)
+			auth.GET("/not-me", h.GetNotMePage)
+			auth.POST("/not-me", h.NotMe)
+			auth.POST("/reauthenticate", h.Reauthenticate, h.protected(RoleUser))
+		}
+
+		admin := v1.Group("/admin", h.protected(RoleAdmin))
+		{
+			admin.PUT("/users/:user_id/role", h.UpdateUserRole, h.requireRecentAuth(recentAuthMaxAge))
+			admin.POST("/users/:user_id/restore", h.RestoreUser)
+			if h.scheduler != nil {
+				admin.GET("/scheduler", h.GetSchedulerStatus)
+			}
+		}
+
+		me := v1.Group("/me", h.protected(RoleUser))
+		{
+			me.GET("", h.GetMe)
+			me.PATCH("", h.UpdateMe)
+			me.DELETE("", h.DeleteAccount, h.requireRecentAuth(recentAuthMaxAge))
+		}
+
+		// These features need the postgres repo.
+		if h.repo != nil {
+			// Invites can grant the admin role, like UpdateUserRole.
+			admin.POST("/invites", h.CreateInvite, h.requireRecentAuth(recentAuthMaxAge))
+			admin.DELETE("/invites/:invite_id", h.DeleteInvite)
+			admin.GET("/audit", h.GetAuditEvents)
+			admin.GET("/users/search", h.SearchUsers)
+			admin.GET("/jobs", h.GetJobs)
+			admin.POST("/jobs/:job_id/retry", h.RetryJob)
+
+			me.GET("/security-events", h.GetSecurityEvents)
+
+			// The page is not protected, so that it can ask the invitee to log in first.
+			v1.GET("/orgs/invitations/accept", h.GetAcceptOrgInvitationPage)
+			orgs := v1.Group("/orgs", h.protected(RoleUser))
+			{
+				orgs.POST("", h.CreateOrganization)
+				orgs.GET("", h.GetOrganizations)
+				orgs.POST("/invitations/accept", h.AcceptOrgInvitation)
+				orgs.GET("/:org_id", h.GetOrganization, h.tenant(OrgRoleMember))
+				orgs.GET("/:org_id/members", h.GetOrganizationMembers, h.tenant(OrgRoleMember))
+				orgs.PATCH("/:org_id/members/:user_id", h.UpdateOrganizationMember, h.tenant(OrgRoleAdmin))
+				orgs.DELETE("/:org_id/members/:user_id", h.DeleteOrganizationMember, h.tenant(OrgRoleMember))
+				orgs.POST("/:org_id/invitations", h.CreateOrgInvitation, h.tenant(OrgRoleAdmin))
+				orgs.DELETE("/:org_id/invitations/:invitation_id", h.DeleteOrgInvitation, h.tenant(OrgRoleAdmin))
+			}
 		}
 	}
 
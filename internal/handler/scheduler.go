@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Get scheduler status
+// @Description Get the scheduled tasks with their schedule, next and last run, and whether this instance is the leader that runs them.
+// @Security ApiKeyAuth
+// @Router /v1/admin/scheduler [get]
+// @Success 200 {object} scheduler.Status
+// @Failure 401 {string} string "invalid session"
+func (h *handler) GetSchedulerStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.scheduler.Status())
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+type updateUserRoleRequest struct {
+	UserId string `param:"user_id" validate:"required"`
+	Role   string `json:"role" validate:"required,oneof=user admin"`
+}
+
+// @Summary Update user role
+// @Description Change the role of a user.
+// @Security ApiKeyAuth
+// @Router /v1/admin/users/{user_id}/role [put]
+// @Success 200 {string} string "Role updated"
+// @Failure 401 {object} reauthenticationRequiredResponse
+// @Failure 404 {string} string "user not found"
+func (h *handler) UpdateUserRole(c echo.Context) error {
+	req := new(updateUserRoleRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user, err := h.users.GetUserById(c.Request().Context(), req.UserId)
+	if err != nil {
+		if errors.Is(err, repo.ErrUserNotFound) {
+			return c.String(http.StatusNotFound, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if err = h.users.Update(c.Request().Context(), user.Id, map[string]any{"role": req.Role}); err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	h.audit(c, repo.AuditRoleChanged, user.Id, map[string]any{"from": user.Role, "to": req.Role})
+	return c.String(http.StatusOK, "Role updated")
+}
+
+// userETag returns the entity tag of the user's current version.
+func userETag(user *repo.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// matchesIfMatch reports whether the If-Match header, if any, matches `etag`.
+func matchesIfMatch(c echo.Context, etag string) bool {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// @Summary Get current user
+// @Description Get the current user. The ETag header holds the user's version, to be sent in If-Match when updating.
+// @Security ApiKeyAuth
+// @Router /v1/me [get]
+// @Success 200 {object} repo.User
+// @Failure 401 {string} string "invalid session"
+func (h *handler) GetMe(c echo.Context) error {
+	user := c.Get("user").(*repo.User)
+	c.Response().Header().Set("ETag", userETag(user))
+	return c.JSON(http.StatusOK, user)
+}
+
+type updateMeRequest struct {
+	FullName    *string `json:"full_name" validate:"omitempty,max=64"`
+	Username    *string `json:"username" validate:"omitempty,max=32"`
+	DateOfBirth *string `json:"date_of_birth"`
+	Gender      *string `json:"gender" validate:"omitempty,oneof=male female other"`
+	PhoneNumber *string `json:"phone_number" validate:"omitempty,max=16"`
+	ImageUrl    *string `json:"image_url" validate:"omitempty,url"`
+}
+
+// @Summary Update current user
+// @Description Update the profile of the current user. Omitted fields are left as is and empty fields are cleared. Send the ETag of GET /v1/me in If-Match to avoid overwriting concurrent changes.
+// @Security ApiKeyAuth
+// @Router /v1/me [patch]
+// @Success 200 {object} repo.User
+// @Failure 401 {string} string "invalid session"
+// @Failure 409 {string} string "username is taken"
+// @Failure 412 {string} string "user has been modified"
+func (h *handler) UpdateMe(c echo.Context) error {
+	req := new(updateMeRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user := c.Get("user").(*repo.User)
+	if !matchesIfMatch(c, userETag(user)) {
+		return c.String(http.StatusPreconditionFailed, repo.ErrVersionConflict.Error())
+	}
+	if req.DateOfBirth != nil && *req.DateOfBirth != "" {
+		if _, err := time.Parse(time.DateOnly, *req.DateOfBirth); err != nil {
+			return c.String(http.StatusUnprocessableEntity, "invalid date of birth")
+		}
+	}
+
+	updates := map[string]any{}
+	for column, value := range map[string]*string{
+		"full_name":     req.FullName,
+		"username":      req.Username,
+		"date_of_birth": req.DateOfBirth,
+		"gender":        req.Gender,
+		"phone_number":  req.PhoneNumber,
+		"image_url":     req.ImageUrl,
+	} {
+		if value == nil {
+			continue
+		}
+		if *value == "" {
+			updates[column] = nil
+		} else {
+			updates[column] = *value
+		}
+	}
+	if len(updates) == 0 {
+		return c.String(http.StatusUnprocessableEntity, "no fields to update")
+	}
+
+	// The version read by the protected middleware is the one the If-Match header was checked against.
+	err := h.users.Update(c.Request().Context(), user.Id, updates, repo.WithExpectedVersion(user.Version))
+	if err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			return c.String(http.StatusPreconditionFailed, err.Error())
+		}
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	user, err = h.users.GetUserById(c.Request().Context(), user.Id)
+	if err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	c.Response().Header().Set("ETag", userETag(user))
+	return c.JSON(http.StatusOK, user)
+}
+
+// @Summary Delete account
+// @Description Delete the current user's account. Requires recent authentication. An admin can restore the account within the retention period.
+// @Security ApiKeyAuth
+// @Router /v1/me [delete]
+// @Success 200 {string} string "Account deleted"
+// @Failure 401 {object} reauthenticationRequiredResponse
+func (h *handler) DeleteAccount(c echo.Context) error {
+	user := c.Get("user").(*repo.User)
+	if err := h.users.SoftDeleteUser(c.Request().Context(), user.Id); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if err := h.revokeSessions(c.Request().Context(), user.Id); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.audit(c, repo.AuditAccountDeleted, user.Id, nil)
+	sess, err := session.Get("session", c)
+	if err == nil {
+		sess.Options = &sessions.Options{
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		}
+		_ = sess.Save(c.Request(), c.Response())
+	}
+	return c.String(http.StatusOK, "Account deleted")
+}
+
+var (
+	ErrRetentionExpired = errors.New("account was deleted too long ago to be restored")
+)
+
+type restoreUserRequest struct {
+	UserId string `param:"user_id" validate:"required"`
+}
+
+// @Summary Restore user
+// @Description Restore a deleted user account within the retention period.
+// @Security ApiKeyAuth
+// @Router /v1/admin/users/{user_id}/restore [post]
+// @Success 200 {object} repo.User
+// @Failure 401 {string} string "invalid session"
+// @Failure 404 {string} string "user not found"
+// @Failure 409 {string} string "user already exists"
+// @Failure 410 {string} string "account was deleted too long ago to be restored"
+func (h *handler) RestoreUser(c echo.Context) error {
+	req := new(restoreUserRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	user, err := h.users.GetUserById(c.Request().Context(), req.UserId, repo.IncludeDeleted())
+	if err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	if user.DeletedAt == nil {
+		return c.String(http.StatusNotFound, repo.ErrUserNotFound.Error())
+	}
+	deletedAt, err := time.Parse(time.RFC3339, *user.DeletedAt)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if time.Since(deletedAt) > repo.DeletedUserRetention {
+		return c.String(http.StatusGone, ErrRetentionExpired.Error())
+	}
+	if err = h.users.RestoreUser(c.Request().Context(), user.Id); err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	if user, err = h.users.GetUserById(c.Request().Context(), user.Id); err != nil {
+		return c.String(repoErrorStatus(err), err.Error())
+	}
+	h.audit(c, repo.AuditAccountRestored, user.Id, nil)
+	return c.JSON(http.StatusOK, user)
+}
+
+type searchUsersRequest struct {
+	Query  string `query:"q"`
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,gte=1,lte=200"`
+}
+
+// @Summary Search users
+// @Description Search users by name, username, email or phone number, best matches first. Free text terms match word prefixes and tolerate typos, and can be combined with the filters `role:`, `status:`, `phone:` and `deleted:true`, such as `role:admin status:active john`. Matched terms are highlighted with <mark> tags.
+// @Security ApiKeyAuth
+// @Router /v1/admin/users/search [get]
+// @Param q query string false "Search query"
+// @Success 200 {object} repo.UserSearchPage
+// @Failure 400 {string} string "invalid search query"
+// @Failure 401 {string} string "invalid session"
+func (h *handler) SearchUsers(c echo.Context) error {
+	req := new(searchUsersRequest)
+	if err := bindAndValidate(c, req); err != nil {
+		return err
+	}
+	search, err := repo.ParseUserSearch(req.Query)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	page, err := h.repo.SearchUsers(c.Request().Context(), search, &repo.Page{Cursor: req.Cursor, Limit: req.Limit})
+	if err != nil {
+		if errors.Is(err, repo.ErrInvalidCursor) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,114 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeStale sets the authentication time of the client's session to longer ago than recent authentication allows.
+func makeStale(c *testClient) {
+	values := c.session()
+	values["auth_time"] = time.Now().Add(-time.Hour).Unix()
+	c.setSession(values)
+}
+
+func TestRecentAuth(t *testing.T) {
+	s := server
+	admin := s.signUp(t, "stepup-admin@test.com", "password123")
+	assert.NoError(t, s.users.Update(context.Background(), admin.me().Id, map[string]any{"role": "admin"}))
+	user := s.signUp(t, "stepup-user@test.com", "password123")
+	userId := user.me().Id
+
+	t.Run("Allow recently authenticated sessions", func(t *testing.T) {
+		res := admin.json(http.MethodPut, "/v1/admin/users/"+userId+"/role", echo.Map{"role": "user"}, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	})
+
+	t.Run("Require reauthentication of stale sessions", func(t *testing.T) {
+		makeStale(admin)
+		res := admin.json(http.MethodPut, "/v1/admin/users/"+userId+"/role", echo.Map{"role": "user"}, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		var body struct {
+			Code          string `json:"code"`
+			MaxAgeSeconds int    `json:"maxAgeSeconds"`
+		}
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+		assert.Equal(t, "reauthentication_required", body.Code)
+		assert.Equal(t, 600, body.MaxAgeSeconds)
+		// Other routes are not affected.
+		assert.Equal(t, http.StatusOK, admin.get("/v1/me").Code)
+
+		res = admin.json(http.MethodPost, "/v1/auth/reauthenticate", echo.Map{"password": "wrongpassword"}, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		res = admin.json(http.MethodPost, "/v1/auth/reauthenticate", echo.Map{"password": "password123"}, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		res = admin.json(http.MethodPut, "/v1/admin/users/"+userId+"/role", echo.Map{"role": "user"}, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	})
+
+	t.Run("Require reauthentication to delete the account", func(t *testing.T) {
+		makeStale(user)
+		assert.Equal(t, http.StatusUnauthorized, user.json(http.MethodDelete, "/v1/me", nil, nil).Code)
+		assert.Equal(t, http.StatusOK, user.get("/v1/me").Code)
+	})
+}
+
+func TestUpdateMe(t *testing.T) {
+	s := server
+	c := s.signUp(t, "update@test.com", "password123")
+	res := c.get("/v1/me")
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	t.Run("Update with the current version", func(t *testing.T) {
+		res := c.json(http.MethodPatch, "/v1/me", echo.Map{"full_name": "First"}, map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		assert.NotEqual(t, etag, res.Header().Get("ETag"))
+		assert.Equal(t, res.Header().Get("ETag"), c.get("/v1/me").Header().Get("ETag"))
+	})
+
+	t.Run("Reject updates of a stale version", func(t *testing.T) {
+		res := c.json(http.MethodPatch, "/v1/me", echo.Map{"full_name": "Second"}, map[string]string{"If-Match": etag})
+		assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+		assert.Equal(t, "First", c.me().FullName)
+	})
+
+	t.Run("Update without If-Match", func(t *testing.T) {
+		res := c.json(http.MethodPatch, "/v1/me", echo.Map{"full_name": "Third"}, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		assert.Equal(t, "Third", c.me().FullName)
+	})
+}
+
+func TestRestoreUser(t *testing.T) {
+	s := server
+	admin := s.signUp(t, "restore-admin@test.com", "password123")
+	assert.NoError(t, s.users.Update(context.Background(), admin.me().Id, map[string]any{"role": "admin"}))
+	user := s.signUp(t, "restore-user@test.com", "password123")
+	userId := user.me().Id
+
+	t.Run("Do not restore users that are not deleted", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, admin.json(http.MethodPost, "/v1/admin/users/"+userId+"/restore", nil, nil).Code)
+		assert.Equal(t, http.StatusNotFound, admin.json(http.MethodPost, "/v1/admin/users/missing/restore", nil, nil).Code)
+	})
+
+	t.Run("Restore deleted users", func(t *testing.T) {
+		res := user.json(http.MethodDelete, "/v1/me", nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, user.get("/v1/me").Code)
+
+		res = admin.json(http.MethodPost, "/v1/admin/users/"+userId+"/restore", nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code, res.Body.String())
+		user = s.logIn(t, "restore-user@test.com", "password123")
+	})
+
+	t.Run("Forbid non-admins", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, user.json(http.MethodPost, "/v1/admin/users/"+userId+"/restore", nil, nil).Code)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+)
+
+// newKVStore returns the KV store of the backend chosen in the config.
+func newKVStore(ctx context.Context, c *config.Server) (kvstore.Store, error) {
+	if c.Env == config.EnvProduction && (c.KVStoreBackend == config.KVStoreMemory || c.KVStoreBackend == config.KVStoreSqlite && c.KVStoreSqliteName == ":memory:") {
+		slog.Warn("The KV store is not persistent: restarts log out all users, and sessions only work on the instance that created them. Use the redis backend, or sqlite with a file name for a single instance.", slog.String("backend", c.KVStoreBackend))
+	}
+	switch c.KVStoreBackend {
+	case config.KVStoreMemory:
+		return kvstore.NewMemory(), nil
+	case config.KVStoreRedis:
+		kv := kvstore.NewRedis(c.KVStoreRedisAddr, kvstore.WithRedisPassword(c.KVStoreRedisPassword), kvstore.WithRedisDB(c.KVStoreRedisDB))
+		if err := kv.Ping(ctx); err != nil {
+			kv.Close()
+			return nil, fmt.Errorf("could not reach redis: %w", err)
+		}
+		return kv, nil
+	default:
+		db, err := database.NewSqlite(c.KVStoreSqliteName, database.WithSqliteSlowQueryThreshold(c.DatabaseSlowQueryThreshold))
+		if err != nil {
+			return nil, err
+		}
+		// The pragmas, such as the busy timeout, are only set on the first connection, and SQLite runs one write at a time anyway.
+		db.SetMaxOpenConns(1)
+		kv, err := kvstore.NewSqlite(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return kv, nil
+	}
+}
@@ -12,16 +12,18 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
-	"time"
 
 	"github.com/rohitxdev/go-api-starter/internal/config"
 	"github.com/rohitxdev/go-api-starter/internal/handler"
 	"github.com/rohitxdev/go-api-starter/pkg/blobstore"
 	"github.com/rohitxdev/go-api-starter/pkg/database"
 	"github.com/rohitxdev/go-api-starter/pkg/email"
-	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/rohitxdev/go-api-starter/pkg/jobs"
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/outbox"
 	"github.com/rohitxdev/go-api-starter/pkg/prettylog"
 	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/rohitxdev/go-api-starter/pkg/scheduler"
 	"go.uber.org/automaxprocs/maxprocs"
 )
 
@@ -70,27 +72,150 @@ func main() {
 		panic("set maxprocs logger: " + err.Error())
 	}
 
-	//Connect to postgres database
-	db, err := database.NewPostgres(c.DatabaseUrl)
-	if err != nil {
-		panic("connect to database: " + err.Error())
+	//Run migrate subcommand
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = runMigrate(c, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate: "+err.Error())
+			os.Exit(1)
+		}
+		return
 	}
-	defer func() {
-		if err = db.Close(); err != nil {
-			panic("close database: " + err.Error())
+
+	//Run reencrypt subcommand
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt" {
+		if err = runReencrypt(c, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "reencrypt: "+err.Error())
+			os.Exit(1)
 		}
-		slog.Debug("Database connection closed")
-	}()
-	slog.Debug("Connected to database")
+		return
+	}
 
-	//Connect to sqlite database
-	sqliteDb, err := database.NewSqlite(":memory:")
-	if err != nil {
-		panic("connect to sqlite database: " + err.Error())
+	//Run seed subcommand
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		if err = runSeed(c, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "seed: "+err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
+	//Connect to database
+	var r *repo.Repo
+	var users repo.UserRepo
+	var jobPool *jobs.Pool
+	// elector stays nil with sqlite, so that every task runs on this instance.
+	var elector scheduler.Elector
+
+	switch c.DatabaseDriver {
+	case config.DatabaseSqlite:
+		db, err := database.NewSqlite(c.DatabaseUrl, database.WithSqliteSlowQueryThreshold(c.DatabaseSlowQueryThreshold))
+		if err != nil {
+			panic("connect to database: " + err.Error())
+		}
+		// SQLite databases are local, so they are migrated on start up.
+		m, err := migrate.New(db, repo.SqliteMigrations, migrate.WithDialect(migrate.SQLite))
+		if err != nil {
+			panic("create migrator: " + err.Error())
+		}
+		if err = m.Up(context.Background(), 0); err != nil {
+			panic("migrate database: " + err.Error())
+		}
+		sqliteUsers := repo.NewSqliteUserRepo(db)
+		defer func() {
+			if err = sqliteUsers.Close(); err != nil {
+				panic("close database: " + err.Error())
+			}
+			slog.Debug("Database connection closed")
+		}()
+		users = sqliteUsers
+	default:
+		db, err := database.NewPostgres(c.DatabaseUrl,
+			database.WithMaxOpenConns(c.DatabaseMaxOpenConns),
+			database.WithMaxIdleConns(c.DatabaseMaxIdleConns),
+			database.WithConnMaxLifetime(c.DatabaseConnMaxLifetime),
+			database.WithConnMaxIdleTime(c.DatabaseConnMaxIdleTime),
+			database.WithConnectTimeout(c.DatabaseConnectTimeout),
+			database.WithConnectRetries(c.DatabaseConnectRetries),
+			database.WithSlowQueryThreshold(c.DatabaseSlowQueryThreshold),
+		)
+		if err != nil {
+			panic("connect to database: " + err.Error())
+		}
+		if err = database.RegisterMetrics(db, "postgres"); err != nil {
+			panic("register database metrics: " + err.Error())
+		}
+		keyring, err := newKeyring(c)
+		if err != nil {
+			panic("create keyring: " + err.Error())
+		}
+		var replicas repo.ReplicaPicker
+		if len(c.DatabaseReplicaUrls) > 0 {
+			pool, err := database.NewReplicaPool(c.DatabaseReplicaUrls,
+				database.WithMaxOpenConns(c.DatabaseMaxOpenConns),
+				database.WithMaxIdleConns(c.DatabaseMaxIdleConns),
+				database.WithConnMaxLifetime(c.DatabaseConnMaxLifetime),
+				database.WithConnMaxIdleTime(c.DatabaseConnMaxIdleTime),
+				database.WithConnectTimeout(c.DatabaseConnectTimeout),
+				database.WithSlowQueryThreshold(c.DatabaseSlowQueryThreshold),
+			)
+			if err != nil {
+				panic("connect to database replicas: " + err.Error())
+			}
+			for i, replicaDb := range pool.DBs() {
+				if err = database.RegisterMetrics(replicaDb, fmt.Sprintf("postgres_replica_%d", i)); err != nil {
+					panic("register database metrics: " + err.Error())
+				}
+			}
+			defer func() {
+				if err = pool.Close(); err != nil {
+					panic("close database replicas: " + err.Error())
+				}
+				slog.Debug("Database replica connections closed")
+			}()
+			replicas = pool
+		}
+		r = repo.New(db, repo.WithKeyring(keyring), repo.WithReplicas(replicas))
+		defer func() {
+			if err = r.Close(); err != nil {
+				panic("close database: " + err.Error())
+			}
+			slog.Debug("Database connection closed")
+		}()
+		users = r
+
+		//Start outbox relay
+		sink, sinkCloser, err := newOutboxSink(c)
+		if err != nil {
+			panic("create outbox sink: " + err.Error())
+		}
+		relayCtx, stopRelay := context.WithCancel(context.Background())
+		relayDone := make(chan struct{})
+		go func() {
+			defer close(relayDone)
+			outbox.NewRelay(r, sink).Run(relayCtx)
+		}()
+		defer func() {
+			stopRelay()
+			<-relayDone
+			if err = sinkCloser.Close(); err != nil {
+				panic("close outbox sink: " + err.Error())
+			}
+			slog.Debug("Outbox relay stopped")
+		}()
+
+		if c.JobWorkers > 0 {
+			jobPool = jobs.NewPool(r, jobs.WithWorkers(c.JobWorkers))
+		}
+
+		// Only the instance holding the lock runs the tasks that are shared by all instances.
+		pgElector := scheduler.NewPostgresElector(db, "maintenance")
+		defer pgElector.Close()
+		elector = pgElector
+	}
+	slog.Debug("Connected to database")
+
 	//Connect to kv store
-	kv, err := kvstore.New(sqliteDb, time.Minute*5)
+	kv, err := newKVStore(context.Background(), c)
 	if err != nil {
 		panic("connect to KV store: " + err.Error())
 	}
@@ -98,12 +223,19 @@ func main() {
 		kv.Close()
 		slog.Debug("KV store closed")
 	}()
-	slog.Debug("Connected to kv store")
+	slog.Debug("Connected to kv store", slog.String("backend", c.KVStoreBackend))
 
-	//Create API handler
-	r := repo.New(db)
-	defer r.Close()
+	//Start scheduler
+	sched := scheduler.New(scheduler.WithElector(elector))
+	registerTasks(sched, kv, r)
+	sched.Start(context.Background())
+	defer func() {
+		sched.Stop()
+		slog.Debug("Scheduler stopped")
+	}()
+	slog.Debug("Scheduler started")
 
+	//Create API handler
 	s3Client, err := blobstore.New(c.S3Endpoint, c.S3DefaultRegion, c.AwsAccessKeyId, c.AwsAccessKeySecret)
 	if err != nil {
 		panic("connect to s3 client: " + err.Error())
@@ -113,9 +245,12 @@ func main() {
 		handler.WithConfig(c),
 		handler.WithKVStore(kv),
 		handler.WithRepo(r),
-		handler.WithEmail(&email.Client{}),
+		handler.WithUserRepo(users),
+		handler.WithEmail(email.New(c.SmtpHost, c.SmtpPort, c.SmtpUsername, c.SmtpPassword)),
 		handler.WithBlobStore(s3Client),
-		handler.WithFileSystem(&fileSystem),
+		handler.WithFileSystem(fileSystem),
+		handler.WithJobs(jobPool),
+		handler.WithScheduler(sched),
 	)
 	if err != nil {
 		panic("create handler: " + err.Error())
@@ -125,6 +260,12 @@ func main() {
 		panic("create router: " + err.Error())
 	}
 
+	//Start job workers, after the handler has registered its jobs
+	if jobPool != nil {
+		jobPool.Start(context.Background())
+		slog.Debug("Job workers started")
+	}
+
 	//Create tcp listener & start server
 	ls, err := net.Listen("tcp", c.Host+":"+c.Port)
 	if err != nil {
@@ -161,4 +302,12 @@ func main() {
 	}
 
 	slog.Debug("Shut down http server gracefully")
+
+	// Jobs that do not finish in time are retried later.
+	if jobPool != nil {
+		if err := jobPool.Shutdown(ctx); err != nil {
+			slog.Warn("Job workers did not drain in time", slog.Any("error", err))
+		}
+		slog.Debug("Job workers stopped")
+	}
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const migrateUsage = `Usage: %s migrate <command> [flags] [steps]
+
+Commands:
+  up [steps]     Apply pending migrations. Applies all if steps is not given.
+  down [steps]   Revert applied migrations. Reverts the last one if steps is not given.
+  status         Show the status of every migration.
+
+Flags:
+`
+
+// runMigrate runs the migrate subcommand with the given arguments.
+func runMigrate(c *config.Server, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the SQL that would run without running it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), migrateUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("missing migrate command")
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	steps := 0
+	if command == "down" {
+		steps = 1
+	}
+	if flags.NArg() > 0 {
+		n, err := strconv.Atoi(flags.Arg(0))
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid steps %q", flags.Arg(0))
+		}
+		steps = n
+	}
+
+	var dryRunOutput io.Writer
+	if *dryRun {
+		dryRunOutput = os.Stdout
+	}
+
+	var db *sql.DB
+	var m *migrate.Migrator
+	var err error
+	switch c.DatabaseDriver {
+	case config.DatabaseSqlite:
+		if db, err = database.NewSqlite(c.DatabaseUrl); err != nil {
+			return err
+		}
+		m, err = migrate.New(db, repo.SqliteMigrations, migrate.WithDialect(migrate.SQLite), migrate.WithLog(os.Stdout), migrate.WithDryRun(dryRunOutput))
+	default:
+		if db, err = database.NewPostgres(c.DatabaseUrl); err != nil {
+			return err
+		}
+		m, err = migrate.New(db, repo.Migrations, migrate.WithLog(os.Stdout), migrate.WithDryRun(dryRunOutput))
+	}
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		return m.Up(ctx, steps)
+	case "down":
+		return m.Down(ctx, steps)
+	case "status":
+		statuses, err := m.Status(ctx)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		if flushErr := w.Flush(); flushErr != nil {
+			return flushErr
+		}
+		return err
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/rohitxdev/go-api-starter/internal/common"
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/pkg/outbox"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// newOutboxSink returns the sink of the outbox relay chosen in the config, and the closer to call once the relay has stopped.
+func newOutboxSink(c *config.Server) (outbox.Sink, common.Closer, error) {
+	switch c.OutboxSink {
+	case "webhook":
+		return outbox.NewWebhookSink(c.OutboxWebhookUrl, c.OutboxWebhookSecret), nopCloser{}, nil
+	case "file":
+		sink, err := outbox.NewFileSink(c.OutboxFilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sink, sink, nil
+	default:
+		return outbox.LogSink{}, nopCloser{}, nil
+	}
+}
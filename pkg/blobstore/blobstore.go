@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -60,6 +61,17 @@ func (s *Store) PresignPutObject(ctx context.Context, bucketName string, fileNam
 	return request, err
 }
 
+// PutObject uploads `body` to the bucket under `fileName`, replacing any existing object.
+func (s *Store) PutObject(ctx context.Context, bucketName string, fileName string, contentType string, body io.Reader) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      &bucketName,
+		Key:         &fileName,
+		ContentType: &contentType,
+		Body:        body,
+	})
+	return err
+}
+
 /*----------------------------------- Get File From Bucket ----------------------------------- */
 
 func (s *Store) PresignGetObject(ctx context.Context, bucketName string, fileName string) (*v4.PresignedHTTPRequest, error) {
@@ -15,8 +15,9 @@ import (
 )
 
 var (
-	ErrTokenExpired   = errors.New("token expired")
-	ErrMalformedToken = errors.New("malformed token")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrMalformedToken     = errors.New("malformed token")
+	ErrCiphertextTooShort = errors.New("ciphertext too short")
 )
 
 // Encrypts data using AES algorithm. The key should be 16, 24, or 32 for 128, 192, or 256 bit encryption respectively.
@@ -50,6 +51,9 @@ func DecryptAES(encryptedData []byte, key []byte) ([]byte, error) {
 		return nil, fmt.Errorf("could not create GCM: %w", err)
 	}
 	nonceSize := gcm.NonceSize()
+	if len(encryptedData) < nonceSize+gcm.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
 
 	//Get nonce from encrypted data
 	nonce, cipher := encryptedData[:nonceSize], encryptedData[nonceSize:]
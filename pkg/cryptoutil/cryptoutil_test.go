@@ -18,4 +18,9 @@ func TestAES(t *testing.T) {
 	assert.Nil(t, err)
 
 	assert.Equal(t, plainText, decryptedData)
+
+	for _, truncated := range [][]byte{nil, encryptedData[:5], encryptedData[:27]} {
+		_, err = cryptoutil.DecryptAES(truncated, key)
+		assert.ErrorIs(t, err, cryptoutil.ErrCiphertextTooShort)
+	}
 }
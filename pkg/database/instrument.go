@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rohitxdev/go-api-starter/internal/common"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultSlowQueryThreshold = time.Millisecond * 200
+
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Duration of database queries.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"system", "query"})
+
+var tracer = otel.Tracer("github.com/rohitxdev/go-api-starter/pkg/database")
+
+type queryNameKey struct{}
+
+// WithQueryName returns a context in which queries are named `name` in metrics, spans and logs. Without a name, queries are named after their statement and table, such as "select users".
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+func queryName(ctx context.Context, query string) string {
+	if name, ok := ctx.Value(queryNameKey{}).(string); ok {
+		return name
+	}
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		return ""
+	}
+	name := fields[0]
+	for i, field := range fields[:len(fields)-1] {
+		if field == "from" || field == "into" || field == "update" || field == "table" {
+			table, _, _ := strings.Cut(fields[i+1], "(")
+			return name + " " + strings.TrimSuffix(table, ";")
+		}
+	}
+	return name
+}
+
+// instrumentedConnector records the duration of queries in a histogram, logs slow queries and traces queries with OpenTelemetry, using the global tracer provider.
+type instrumentedConnector struct {
+	driver.Connector
+	system             attribute.KeyValue
+	slowQueryThreshold time.Duration
+}
+
+// dsnConnector opens connections with drivers that do not implement driver.DriverContext.
+type dsnConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+// openInstrumented opens a database like sql.Open, with its queries instrumented.
+func openInstrumented(driverName string, dsn string, system attribute.KeyValue, slowQueryThreshold time.Duration) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	if err = db.Close(); err != nil {
+		return nil, err
+	}
+
+	var connector driver.Connector = dsnConnector{dsn: dsn, drv: drv}
+	if driverCtx, ok := drv.(driver.DriverContext); ok {
+		if connector, err = driverCtx.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(&instrumentedConnector{Connector: connector, system: system, slowQueryThreshold: slowQueryThreshold}), nil
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, connector: c}, nil
+}
+
+// start starts timing and tracing a query. The returned function must be called with the error of the query when it has finished.
+func (c *instrumentedConnector) start(ctx context.Context, query string) (context.Context, func(err error)) {
+	name := queryName(ctx, query)
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(c.system, semconv.DBQueryText(query)))
+	start := time.Now()
+	return ctx, func(err error) {
+		duration := time.Since(start)
+		queryDuration.WithLabelValues(c.system.Value.AsString(), name).Observe(duration.Seconds())
+		if err != nil && !errors.Is(err, driver.ErrSkip) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		if c.slowQueryThreshold > 0 && duration >= c.slowQueryThreshold {
+			slog.WarnContext(ctx, "Slow database query",
+				slog.String("query", name),
+				slog.String("statement", query),
+				slog.Duration("duration", duration),
+				slog.String("request_id", common.RequestId(ctx)),
+			)
+		}
+	}
+}
+
+type instrumentedConn struct {
+	driver.Conn
+	connector *instrumentedConnector
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query, conn: c}, nil
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("driver does not support transaction options")
+	}
+	// Begin is deprecated, but is all that drivers without ConnBeginTx implement.
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := c.connector.start(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	done(err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := c.connector.start(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	done(err)
+	return rows, err
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *instrumentedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+	conn  *instrumentedConn
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, done := s.conn.connector.start(ctx, s.query)
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(namedValuesToValues(args))
+	}
+	done(err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, done := s.conn.connector.start(ctx, s.query)
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValuesToValues(args))
+	}
+	done(err)
+	return rows, err
+}
+
+func (s *instrumentedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return s.conn.CheckNamedValue(value)
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,63 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rohitxdev/go-api-starter/internal/common"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentation(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	db, err := database.NewSqlite(":memory:", database.WithSqliteSlowQueryThreshold(time.Nanosecond))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	ctx := common.WithRequestId(context.Background(), "req_test")
+	_, err = db.ExecContext(ctx, "CREATE TABLE things(id INTEGER PRIMARY KEY);")
+	assert.Nil(t, err)
+	_, err = db.ExecContext(database.WithQueryName(ctx, "CreateThing"), "INSERT INTO things(id) VALUES($1);", 1)
+	assert.Nil(t, err)
+	stmt, err := db.PrepareContext(ctx, "SELECT id FROM things WHERE id = $1;")
+	assert.Nil(t, err)
+	defer stmt.Close()
+	var thingId int
+	assert.Nil(t, stmt.QueryRowContext(ctx, 1).Scan(&thingId))
+
+	t.Run("Histogram per query", func(t *testing.T) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		assert.Nil(t, err)
+		queries := map[string]bool{}
+		for _, family := range families {
+			if family.GetName() != "db_query_duration_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "query" {
+						queries[label.GetValue()] = true
+					}
+				}
+			}
+		}
+		for _, name := range []string{"create things", "CreateThing", "select things"} {
+			assert.True(t, queries[name], name)
+		}
+	})
+
+	t.Run("Slow query log", func(t *testing.T) {
+		assert.Contains(t, logs.String(), "Slow database query")
+		assert.Contains(t, logs.String(), "query=CreateThing")
+		assert.Contains(t, logs.String(), "request_id=req_test")
+	})
+}
@@ -1,19 +1,143 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func NewPostgres(connStr string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", connStr)
+const maxConnectBackoff = time.Second * 10
+
+type postgresOpts struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+	connectTimeout  time.Duration
+	connectRetries  int
+	// healthCheckInterval is how often replicas are health checked.
+	healthCheckInterval time.Duration
+	slowQueryThreshold  time.Duration
+}
+
+// WithMaxOpenConns limits the number of open connections. Zero means unlimited.
+func WithMaxOpenConns(n int) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns limits the number of idle connections kept in the pool.
+func WithMaxIdleConns(n int) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime closes connections after they have been open for `d`. Zero means forever.
+func WithConnMaxLifetime(d time.Duration) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.connMaxLifetime = d
+	}
+}
+
+// WithConnMaxIdleTime closes connections after they have been idle for `d`. Zero means forever.
+func WithConnMaxIdleTime(d time.Duration) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.connMaxIdleTime = d
+	}
+}
+
+// WithConnectTimeout limits how long each attempt to reach the database may take.
+func WithConnectTimeout(d time.Duration) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.connectTimeout = d
+	}
+}
+
+// WithConnectRetries retries reaching the database up to `n` times with exponential backoff, for when the database starts up alongside the server.
+func WithConnectRetries(n int) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.connectRetries = n
+	}
+}
+
+// WithHealthCheckInterval sets how often the replicas of a ReplicaPool are health checked.
+func WithHealthCheckInterval(d time.Duration) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.healthCheckInterval = d
+	}
+}
+
+// WithSlowQueryThreshold logs queries that take at least `d`. Zero disables the log. The default is 200ms.
+func WithSlowQueryThreshold(d time.Duration) func(*postgresOpts) {
+	return func(po *postgresOpts) {
+		po.slowQueryThreshold = d
+	}
+}
+
+func newPostgresOpts(optFuncs []func(*postgresOpts)) postgresOpts {
+	opts := postgresOpts{
+		maxIdleConns:        2,
+		connectTimeout:      time.Second * 5,
+		healthCheckInterval: time.Second * 5,
+		slowQueryThreshold:  defaultSlowQueryThreshold,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return opts
+}
+
+// openPostgres opens an instrumented postgres database with the pool settings of `opts`, without connecting to it.
+func openPostgres(connStr string, opts *postgresOpts) (*sql.DB, error) {
+	db, err := openInstrumented("postgres", connStr, semconv.DBSystemPostgreSQL, opts.slowQueryThreshold)
 	if err != nil {
 		return nil, fmt.Errorf("could not open postgres database: %w", err)
 	}
+	db.SetMaxOpenConns(opts.maxOpenConns)
+	db.SetMaxIdleConns(opts.maxIdleConns)
+	db.SetConnMaxLifetime(opts.connMaxLifetime)
+	db.SetConnMaxIdleTime(opts.connMaxIdleTime)
+	return db, nil
+}
 
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("could not ping postgres database: %w", err)
+// NewPostgres connects to a postgres database. Its queries are instrumented with a latency histogram, a slow query log and OpenTelemetry spans.
+func NewPostgres(connStr string, optFuncs ...func(*postgresOpts)) (*sql.DB, error) {
+	opts := newPostgresOpts(optFuncs)
+	db, err := openPostgres(connStr, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := time.Millisecond * 500
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.connectTimeout)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt >= opts.connectRetries {
+			db.Close()
+			return nil, fmt.Errorf("could not ping postgres database: %w", err)
+		}
+		slog.Warn("Could not ping postgres database, retrying", slog.Duration("backoff", backoff), slog.Any("error", err))
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxConnectBackoff)
 	}
 
 	return db, nil
 }
+
+// RegisterMetrics exports the connection pool stats of `db`, such as connections in use, idle connections, and the number and duration of waits for a connection, as Prometheus metrics labelled with `name`.
+func RegisterMetrics(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// ReplicaPool holds connections to the read replicas of a postgres database and picks a healthy one round-robin. Replicas are health checked periodically and can be marked down by callers when a query fails to reach them.
+type ReplicaPool struct {
+	replicas []*replica
+	next     atomic.Uint64
+	done     chan struct{}
+	wg       sync.WaitGroup
+	opts     postgresOpts
+}
+
+// NewReplicaPool opens the replicas at `connStrs` with the same pool settings as NewPostgres. Replicas that cannot be reached are marked down instead of failing, and are picked again once they pass a health check.
+func NewReplicaPool(connStrs []string, optFuncs ...func(*postgresOpts)) (*ReplicaPool, error) {
+	opts := newPostgresOpts(optFuncs)
+	p := &ReplicaPool{done: make(chan struct{}), opts: opts}
+	for i, connStr := range connStrs {
+		db, err := openPostgres(connStr, &opts)
+		if err != nil {
+			_ = p.Close()
+			return nil, fmt.Errorf("could not open replica %d: %w", i, err)
+		}
+		p.replicas = append(p.replicas, &replica{db: db})
+	}
+	p.checkHealth()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(opts.healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.checkHealth()
+			}
+		}
+	}()
+
+	return p, nil
+}
+
+func (p *ReplicaPool) checkHealth() {
+	for i, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.connectTimeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		if wasHealthy := r.healthy.Swap(err == nil); wasHealthy != (err == nil) {
+			if err != nil {
+				slog.Warn("Replica is down", slog.Int("replica", i), slog.Any("error", err))
+			} else {
+				slog.Info("Replica is up", slog.Int("replica", i))
+			}
+		}
+	}
+}
+
+// Pick returns the next healthy replica, or nil if all replicas are down.
+func (p *ReplicaPool) Pick() *sql.DB {
+	n := uint64(len(p.replicas))
+	start := p.next.Add(1)
+	for i := range n {
+		if r := p.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+// MarkDown excludes the replica from Pick until it passes the next health check.
+func (p *ReplicaPool) MarkDown(db *sql.DB) {
+	for i, r := range p.replicas {
+		if r.db == db && r.healthy.Swap(false) {
+			slog.Warn("Replica is down", slog.Int("replica", i))
+		}
+	}
+}
+
+// DBs returns the connections to all replicas, for example to register their metrics.
+func (p *ReplicaPool) DBs() []*sql.DB {
+	dbs := make([]*sql.DB, len(p.replicas))
+	for i, r := range p.replicas {
+		dbs[i] = r.db
+	}
+	return dbs
+}
+
+// Close stops the health checks and closes all replicas.
+func (p *ReplicaPool) Close() error {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	p.wg.Wait()
+	var errList []error
+	for _, r := range p.replicas {
+		if err := r.db.Close(); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return errors.Join(errList...)
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	_ "modernc.org/sqlite"
 )
 
@@ -30,8 +32,24 @@ func createDirIfNotExists(path string) error {
 	return nil
 }
 
-// Pass :memory: for in-memory database.
-func NewSqlite(dbName string) (*sql.DB, error) {
+type sqliteOpts struct {
+	slowQueryThreshold time.Duration
+}
+
+// WithSqliteSlowQueryThreshold logs queries that take at least `d`. Zero disables the log. The default is 200ms.
+func WithSqliteSlowQueryThreshold(d time.Duration) func(*sqliteOpts) {
+	return func(so *sqliteOpts) {
+		so.slowQueryThreshold = d
+	}
+}
+
+// Pass :memory: for in-memory database. Queries are instrumented like those of NewPostgres.
+func NewSqlite(dbName string, optFuncs ...func(*sqliteOpts)) (*sql.DB, error) {
+	opts := sqliteOpts{slowQueryThreshold: defaultSlowQueryThreshold}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	if dbName != ":memory:" {
 		if err := createDirIfNotExists(dirName); err != nil {
 			return nil, err
@@ -39,11 +57,16 @@ func NewSqlite(dbName string) (*sql.DB, error) {
 		dbName = fmt.Sprintf("%s/%s.db", dirName, dbName)
 	}
 
-	db, err := sql.Open("sqlite", dbName)
+	db, err := openInstrumented("sqlite", dbName, semconv.DBSystemSqlite, opts.slowQueryThreshold)
 	if err != nil {
 		return nil, fmt.Errorf("could not open sqlite database: %w", err)
 	}
 
+	// Every connection to :memory: opens a separate database, so all queries must share one connection.
+	if dbName == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
 	stmts := [...]string{
 		"PRAGMA journal_mode = WAL;",
 		"PRAGMA synchronous = NORMAL;",
@@ -2,6 +2,7 @@ package database_test
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/rohitxdev/go-api-starter/pkg/database"
@@ -16,7 +17,12 @@ func TestSqlite(t *testing.T) {
 		defer db.Close()
 	})
 
+	// NewSqlite creates the database file, with its WAL files, in the db directory.
 	t.Cleanup(func() {
-		os.RemoveAll(dbName)
+		for _, suffix := range [...]string{".db", ".db-wal", ".db-shm"} {
+			os.Remove(filepath.Join("db", dbName+suffix))
+		}
+		// The directory is only removed if the test created it, that is if it is empty.
+		os.Remove("db")
 	})
 }
@@ -15,6 +15,10 @@ type Client struct {
 	dialer *gomail.Dialer
 }
 
+func New(host string, port int, username string, password string) *Client {
+	return &Client{dialer: NewSMTPClient(host, port, username, password)}
+}
+
 /*----------------------------------- Send Email ----------------------------------- */
 
 type Email struct {
@@ -15,12 +15,24 @@ const (
 	Request = iota
 	User
 	Session
+	Invite
+	Organization
+	AuditEvent
+	Device
+	OutboxEvent
+	Job
 )
 
 var prefixes = map[prefix]string{
-	Request: "req",
-	User:    "usr",
-	Session: "ses",
+	Request:      "req",
+	User:         "usr",
+	Session:      "ses",
+	Invite:       "inv",
+	Organization: "org",
+	AuditEvent:   "evt",
+	Device:       "dev",
+	OutboxEvent:  "obx",
+	Job:          "job",
 }
 
 func New(prefix prefix) string {
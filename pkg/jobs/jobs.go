@@ -0,0 +1,74 @@
+// Package jobs runs background jobs queued in the postgres repo with a pool of workers.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+// Queue enqueues jobs. It is implemented by *repo.Repo, including repos inside WithTx, in which case the job only runs if the transaction commits.
+type Queue interface {
+	EnqueueJob(ctx context.Context, job *repo.Job) (string, error)
+}
+
+// Kind is a kind of job whose payload is of type T. Define kinds as package variables and use them both to enqueue jobs and to register their handler.
+type Kind[T any] struct {
+	name string
+}
+
+func NewKind[T any](name string) Kind[T] {
+	return Kind[T]{name: name}
+}
+
+func (k Kind[T]) Name() string {
+	return k.name
+}
+
+type enqueueOpts struct {
+	runAt       time.Time
+	uniqueKey   string
+	maxAttempts int
+}
+
+// WithRunAt runs the job no earlier than `t`, instead of as soon as possible.
+func WithRunAt(t time.Time) func(*enqueueOpts) {
+	return func(eo *enqueueOpts) {
+		eo.runAt = t
+	}
+}
+
+// WithUniqueKey makes Enqueue fail with repo.ErrJobAlreadyQueued while a job of the same kind with the same key is pending or running.
+func WithUniqueKey(key string) func(*enqueueOpts) {
+	return func(eo *enqueueOpts) {
+		eo.uniqueKey = key
+	}
+}
+
+// WithMaxAttempts sets how many times the job is run before it fails. The default is 5.
+func WithMaxAttempts(n int) func(*enqueueOpts) {
+	return func(eo *enqueueOpts) {
+		eo.maxAttempts = n
+	}
+}
+
+// Enqueue adds a job of this kind with `payload` to the queue and returns its id.
+func (k Kind[T]) Enqueue(ctx context.Context, queue Queue, payload T, optFuncs ...func(*enqueueOpts)) (string, error) {
+	opts := enqueueOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return queue.EnqueueJob(ctx, &repo.Job{
+		Kind:        k.name,
+		Payload:     data,
+		UniqueKey:   opts.uniqueKey,
+		RunAt:       opts.runAt,
+		MaxAttempts: opts.maxAttempts,
+	})
+}
@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const maxRetryBackoff = time.Hour
+
+var (
+	jobsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "Number of job runs by result: succeeded, retried or failed.",
+	}, []string{"kind", "result"})
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_duration_seconds",
+		Help:    "Duration of job runs.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 4, 10),
+	}, []string{"kind"})
+	jobsRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_running",
+		Help: "Number of jobs being run.",
+	}, []string{"kind"})
+)
+
+// Store is the job table. It is implemented by *repo.Repo.
+type Store interface {
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]repo.Job, error)
+	CompleteJob(ctx context.Context, jobId string) error
+	RetryJob(ctx context.Context, jobId string, lastError string, runAt time.Time) error
+	FailJob(ctx context.Context, jobId string, lastError string) error
+}
+
+type poolOpts struct {
+	workers      int
+	pollInterval time.Duration
+	lease        time.Duration
+	retryBackoff time.Duration
+}
+
+// WithWorkers sets how many jobs are run at the same time. The default is 4.
+func WithWorkers(n int) func(*poolOpts) {
+	return func(po *poolOpts) {
+		po.workers = n
+	}
+}
+
+// WithPollInterval sets how long idle workers wait before polling for due jobs again. The default is 1s.
+func WithPollInterval(d time.Duration) func(*poolOpts) {
+	return func(po *poolOpts) {
+		po.pollInterval = d
+	}
+}
+
+// WithLease sets how long a job may run before it is considered abandoned and is claimed again. The default is 5m.
+func WithLease(d time.Duration) func(*poolOpts) {
+	return func(po *poolOpts) {
+		po.lease = d
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry of a failed job, which doubles with each attempt up to an hour. The default is 10s.
+func WithRetryBackoff(d time.Duration) func(*poolOpts) {
+	return func(po *poolOpts) {
+		po.retryBackoff = d
+	}
+}
+
+// Pool runs the jobs of the registered kinds. Several pools, for example in several server instances, can share a queue, as each job is claimed by one worker.
+type Pool struct {
+	store    Store
+	opts     poolOpts
+	handlers map[string]func(ctx context.Context, payload json.RawMessage) error
+	// stop stops workers from claiming jobs, and cancel cancels the jobs being run.
+	stop   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewPool(store Store, optFuncs ...func(*poolOpts)) *Pool {
+	opts := poolOpts{
+		workers:      4,
+		pollInterval: time.Second,
+		lease:        time.Minute * 5,
+		retryBackoff: time.Second * 10,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return &Pool{
+		store:    store,
+		opts:     opts,
+		handlers: map[string]func(ctx context.Context, payload json.RawMessage) error{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Handle registers the handler of the jobs of `kind`. Jobs whose handler returns an error are retried with backoff until they run out of attempts. Register all handlers before calling Start.
+func Handle[T any](p *Pool, kind Kind[T], handler func(ctx context.Context, payload T) error) {
+	p.handlers[kind.name] = func(ctx context.Context, data json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return fmt.Errorf("could not decode payload: %w", err)
+		}
+		return handler(ctx, payload)
+	}
+}
+
+// Start starts the workers. Jobs are run with a context derived from `ctx`.
+func (p *Pool) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	kinds := make([]string, 0, len(p.handlers))
+	for kind := range p.handlers {
+		kinds = append(kinds, kind)
+	}
+	for range p.opts.workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(ctx, kinds)
+		}()
+	}
+}
+
+// Shutdown stops claiming jobs and waits for the jobs being run to finish. If `ctx` is done first, their contexts are canceled and Shutdown returns once they have returned. Jobs interrupted this way are retried. Call it once, after Start.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	close(p.stop)
+	defer p.cancel()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work(ctx context.Context, kinds []string) {
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+		jobs, err := p.store.ClaimJobs(ctx, kinds, 1, p.opts.lease)
+		if err != nil {
+			slog.ErrorContext(ctx, "claim jobs", slog.Any("error", err))
+		}
+		if len(jobs) > 0 {
+			p.run(ctx, &jobs[0])
+			continue
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.opts.pollInterval):
+		}
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job *repo.Job) {
+	jobsRunning.WithLabelValues(job.Kind).Inc()
+	start := time.Now()
+	err := p.handle(ctx, job)
+	jobDuration.WithLabelValues(job.Kind).Observe(time.Since(start).Seconds())
+	jobsRunning.WithLabelValues(job.Kind).Dec()
+
+	// The job is recorded even if it was interrupted by a shutdown.
+	ctx = context.WithoutCancel(ctx)
+	logAttrs := []any{slog.String("id", job.Id), slog.String("kind", job.Kind), slog.Int("attempts", job.Attempts)}
+	switch {
+	case err == nil:
+		jobsProcessed.WithLabelValues(job.Kind, "succeeded").Inc()
+		err = p.store.CompleteJob(ctx, job.Id)
+	case job.Attempts >= job.MaxAttempts:
+		jobsProcessed.WithLabelValues(job.Kind, "failed").Inc()
+		slog.ErrorContext(ctx, "job failed", append(logAttrs, slog.Any("error", err))...)
+		err = p.store.FailJob(ctx, job.Id, err.Error())
+	default:
+		jobsProcessed.WithLabelValues(job.Kind, "retried").Inc()
+		slog.WarnContext(ctx, "job will be retried", append(logAttrs, slog.Any("error", err))...)
+		err = p.store.RetryJob(ctx, job.Id, err.Error(), time.Now().Add(p.backoff(job.Attempts)))
+	}
+	// The job is claimed again once its lease expires.
+	if err != nil {
+		slog.ErrorContext(ctx, "record job result", append(logAttrs, slog.Any("error", err))...)
+	}
+}
+
+// handle runs the handler of the job, turning panics into errors.
+func (p *Pool) handle(ctx context.Context, job *repo.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return p.handlers[job.Kind](ctx, job.Payload)
+}
+
+func (p *Pool) backoff(attempts int) time.Duration {
+	backoff := float64(p.opts.retryBackoff) * math.Pow(2, float64(attempts-1))
+	return time.Duration(min(backoff, float64(maxRetryBackoff)))
+}
@@ -0,0 +1,208 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/jobs"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryQueue is an in-memory job table.
+type memoryQueue struct {
+	mu   sync.Mutex
+	jobs []repo.Job
+}
+
+func (q *memoryQueue) EnqueueJob(ctx context.Context, job *repo.Job) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, queued := range q.jobs {
+		if job.UniqueKey != "" && queued.Kind == job.Kind && queued.UniqueKey == job.UniqueKey && (queued.Status == repo.JobPending || queued.Status == repo.JobRunning) {
+			return "", repo.ErrJobAlreadyQueued
+		}
+	}
+	queued := *job
+	queued.Id = string(rune('a' + len(q.jobs)))
+	queued.Status = repo.JobPending
+	if queued.MaxAttempts == 0 {
+		queued.MaxAttempts = 5
+	}
+	q.jobs = append(q.jobs, queued)
+	return queued.Id, nil
+}
+
+func (q *memoryQueue) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]repo.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var claimed []repo.Job
+	for i := range q.jobs {
+		job := &q.jobs[i]
+		if job.Status != repo.JobPending || job.RunAt.After(time.Now()) || !slices.Contains(kinds, job.Kind) || len(claimed) == limit {
+			continue
+		}
+		job.Status = repo.JobRunning
+		job.Attempts++
+		claimed = append(claimed, *job)
+	}
+	return claimed, nil
+}
+
+func (q *memoryQueue) update(jobId string, fn func(job *repo.Job)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.jobs {
+		if q.jobs[i].Id == jobId {
+			fn(&q.jobs[i])
+		}
+	}
+	return nil
+}
+
+func (q *memoryQueue) CompleteJob(ctx context.Context, jobId string) error {
+	return q.update(jobId, func(job *repo.Job) { job.Status = repo.JobSucceeded })
+}
+
+func (q *memoryQueue) RetryJob(ctx context.Context, jobId string, lastError string, runAt time.Time) error {
+	return q.update(jobId, func(job *repo.Job) {
+		job.Status = repo.JobPending
+		job.LastError = lastError
+		job.RunAt = runAt
+	})
+}
+
+func (q *memoryQueue) FailJob(ctx context.Context, jobId string, lastError string) error {
+	return q.update(jobId, func(job *repo.Job) {
+		job.Status = repo.JobFailed
+		job.LastError = lastError
+	})
+}
+
+func (q *memoryQueue) job(jobId string) repo.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.jobs {
+		if job.Id == jobId {
+			return job
+		}
+	}
+	return repo.Job{}
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+var greetJob = jobs.NewKind[greeting]("test.greet")
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Run typed jobs", func(t *testing.T) {
+		queue := &memoryQueue{}
+		pool := jobs.NewPool(queue, jobs.WithPollInterval(time.Millisecond))
+		greeted := make(chan string, 1)
+		jobs.Handle(pool, greetJob, func(ctx context.Context, payload greeting) error {
+			greeted <- payload.Name
+			return nil
+		})
+		pool.Start(ctx)
+		defer pool.Shutdown(ctx)
+
+		jobId, err := greetJob.Enqueue(ctx, queue, greeting{Name: "gopher"})
+		assert.Nil(t, err)
+		assert.Equal(t, "gopher", <-greeted)
+		assert.Eventually(t, func() bool { return queue.job(jobId).Status == repo.JobSucceeded }, time.Second, time.Millisecond)
+	})
+
+	t.Run("Scheduled jobs", func(t *testing.T) {
+		queue := &memoryQueue{}
+		runAt := time.Now().Add(time.Hour)
+		jobId, err := greetJob.Enqueue(ctx, queue, greeting{}, jobs.WithRunAt(runAt))
+		assert.Nil(t, err)
+		assert.Equal(t, runAt, queue.job(jobId).RunAt)
+	})
+
+	t.Run("Unique keys", func(t *testing.T) {
+		queue := &memoryQueue{}
+		_, err := greetJob.Enqueue(ctx, queue, greeting{}, jobs.WithUniqueKey("usr_1"))
+		assert.Nil(t, err)
+		_, err = greetJob.Enqueue(ctx, queue, greeting{}, jobs.WithUniqueKey("usr_1"))
+		assert.ErrorIs(t, err, repo.ErrJobAlreadyQueued)
+	})
+
+	t.Run("Retry and fail", func(t *testing.T) {
+		queue := &memoryQueue{}
+		pool := jobs.NewPool(queue, jobs.WithPollInterval(time.Millisecond), jobs.WithRetryBackoff(time.Millisecond))
+		jobs.Handle(pool, greetJob, func(ctx context.Context, payload greeting) error {
+			return errors.New("smtp is down")
+		})
+		jobId, err := greetJob.Enqueue(ctx, queue, greeting{}, jobs.WithMaxAttempts(3))
+		assert.Nil(t, err)
+		pool.Start(ctx)
+		defer pool.Shutdown(ctx)
+
+		assert.Eventually(t, func() bool { return queue.job(jobId).Status == repo.JobFailed }, time.Second, time.Millisecond)
+		job := queue.job(jobId)
+		assert.Equal(t, 3, job.Attempts)
+		assert.Equal(t, "smtp is down", job.LastError)
+	})
+
+	t.Run("Panics fail the run", func(t *testing.T) {
+		queue := &memoryQueue{}
+		pool := jobs.NewPool(queue, jobs.WithPollInterval(time.Millisecond))
+		jobs.Handle(pool, greetJob, func(ctx context.Context, payload greeting) error {
+			panic("boom")
+		})
+		jobId, err := greetJob.Enqueue(ctx, queue, greeting{}, jobs.WithMaxAttempts(1))
+		assert.Nil(t, err)
+		pool.Start(ctx)
+		defer pool.Shutdown(ctx)
+
+		assert.Eventually(t, func() bool { return queue.job(jobId).Status == repo.JobFailed }, time.Second, time.Millisecond)
+		assert.Contains(t, queue.job(jobId).LastError, "boom")
+	})
+
+	t.Run("Drain on shutdown", func(t *testing.T) {
+		queue := &memoryQueue{}
+		pool := jobs.NewPool(queue, jobs.WithPollInterval(time.Millisecond))
+		started := make(chan struct{})
+		jobs.Handle(pool, greetJob, func(ctx context.Context, payload greeting) error {
+			close(started)
+			time.Sleep(time.Millisecond * 50)
+			return nil
+		})
+		jobId, err := greetJob.Enqueue(ctx, queue, greeting{})
+		assert.Nil(t, err)
+		pool.Start(ctx)
+		<-started
+
+		assert.Nil(t, pool.Shutdown(ctx))
+		assert.Equal(t, repo.JobSucceeded, queue.job(jobId).Status)
+	})
+
+	t.Run("Cancel jobs that do not drain in time", func(t *testing.T) {
+		queue := &memoryQueue{}
+		pool := jobs.NewPool(queue, jobs.WithPollInterval(time.Millisecond))
+		started := make(chan struct{})
+		jobs.Handle(pool, greetJob, func(ctx context.Context, payload greeting) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		jobId, err := greetJob.Enqueue(ctx, queue, greeting{})
+		assert.Nil(t, err)
+		pool.Start(ctx)
+		<-started
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+		defer cancel()
+		assert.ErrorIs(t, pool.Shutdown(shutdownCtx), context.DeadlineExceeded)
+		assert.Equal(t, repo.JobPending, queue.job(jobId).Status)
+	})
+}
@@ -0,0 +1,367 @@
+package kvstore
+
+import (
+	"container/heap"
+	"context"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryShards is the number of shards of a MemoryStore. Keys are spread across shards, each with its own lock, so that operations on different keys rarely contend.
+const memoryShards = 64
+
+// MemoryStore is a Store in memory. Keys are lost on restart and are not shared across instances.
+type MemoryStore struct {
+	shards [memoryShards]memoryShard
+	now    func() time.Time
+}
+
+type memoryShard struct {
+	mu    sync.Mutex
+	items map[string]*memoryItem
+	// expiries holds the items that expire, soonest first, so that Purge does not scan all items.
+	expiries expiryHeap
+}
+
+type memoryItem struct {
+	key   string
+	value string
+	// expiresAt is zero for items that do not expire.
+	expiresAt time.Time
+	// index is the index of the item in the expiry heap, or -1 if it is not in it.
+	index int
+}
+
+// NewMemory returns an empty store. Expired keys are not returned, and are deleted by Purge.
+func NewMemory(optFuncs ...func(*kvOpts)) *MemoryStore {
+	opts := newKVOpts(optFuncs)
+	kv := &MemoryStore{now: opts.now}
+	for i := range kv.shards {
+		kv.shards[i].items = map[string]*memoryItem{}
+	}
+	return kv
+}
+
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % memoryShards)
+}
+
+// shard locks and returns the shard of the key. The caller must unlock it.
+func (kv *MemoryStore) shard(key string) *memoryShard {
+	s := &kv.shards[shardIndex(key)]
+	s.mu.Lock()
+	return s
+}
+
+// get returns the item of the key, or nil if it does not exist. Expired items are deleted.
+func (s *memoryShard) get(key string, now time.Time) *memoryItem {
+	item, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if !item.expiresAt.IsZero() && !item.expiresAt.After(now) {
+		s.delete(item)
+		return nil
+	}
+	return item
+}
+
+func (s *memoryShard) set(key string, value string, expiresAt time.Time) {
+	item, ok := s.items[key]
+	if !ok {
+		item = &memoryItem{key: key, index: -1}
+		s.items[key] = item
+	}
+	item.value = value
+	s.setExpiry(item, expiresAt)
+}
+
+func (s *memoryShard) setExpiry(item *memoryItem, expiresAt time.Time) {
+	item.expiresAt = expiresAt
+	switch {
+	case item.index >= 0 && expiresAt.IsZero():
+		heap.Remove(&s.expiries, item.index)
+	case item.index >= 0:
+		heap.Fix(&s.expiries, item.index)
+	case !expiresAt.IsZero():
+		heap.Push(&s.expiries, item)
+	}
+}
+
+func (s *memoryShard) delete(item *memoryItem) {
+	if item.index >= 0 {
+		heap.Remove(&s.expiries, item.index)
+	}
+	delete(s.items, item.key)
+}
+
+// expiresAt returns the expiry of a key set now with `ttl`, or the zero time if it does not expire.
+func (kv *MemoryStore) expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return kv.now().Add(ttl)
+}
+
+func (kv *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	item := s.get(key, kv.now())
+	if item == nil {
+		return "", ErrKeyNotFound
+	}
+	return item.value, nil
+}
+
+func (kv *MemoryStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	s.set(key, value, kv.expiresAt(ttl))
+	return nil
+}
+
+func (kv *MemoryStore) Delete(ctx context.Context, key string) error {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	if item, ok := s.items[key]; ok {
+		s.delete(item)
+	}
+	return nil
+}
+
+func (kv *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	now := kv.now()
+	item := s.get(key, now)
+	if item == nil {
+		return 0, ErrKeyNotFound
+	}
+	if item.expiresAt.IsZero() {
+		return NoExpiry, nil
+	}
+	return item.expiresAt.Sub(now), nil
+}
+
+func (kv *MemoryStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	item := s.get(key, kv.now())
+	if item == nil {
+		return ErrKeyNotFound
+	}
+	if ttl <= 0 {
+		s.delete(item)
+		return nil
+	}
+	s.setExpiry(item, kv.expiresAt(ttl))
+	return nil
+}
+
+func (kv *MemoryStore) Persist(ctx context.Context, key string) error {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	item := s.get(key, kv.now())
+	if item == nil {
+		return ErrKeyNotFound
+	}
+	s.setExpiry(item, time.Time{})
+	return nil
+}
+
+func (kv *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return kv.IncrBy(ctx, key, 1, ttl)
+}
+
+func (kv *MemoryStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	item := s.get(key, kv.now())
+	if item == nil {
+		s.set(key, strconv.FormatInt(delta, 10), kv.expiresAt(ttl))
+		return delta, nil
+	}
+	n, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	n += delta
+	item.value = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (kv *MemoryStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	if s.get(key, kv.now()) != nil {
+		return false, nil
+	}
+	s.set(key, value, kv.expiresAt(ttl))
+	return true, nil
+}
+
+func (kv *MemoryStore) GetDel(ctx context.Context, key string) (string, error) {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	item := s.get(key, kv.now())
+	if item == nil {
+		return "", ErrKeyNotFound
+	}
+	s.delete(item)
+	return item.value, nil
+}
+
+func (kv *MemoryStore) CompareAndSwap(ctx context.Context, key string, old string, new string) (bool, error) {
+	s := kv.shard(key)
+	defer s.mu.Unlock()
+	item := s.get(key, kv.now())
+	if item == nil || item.value != old {
+		return false, nil
+	}
+	item.value = new
+	return true, nil
+}
+
+// Scan collects and sorts the matching keys of all shards for every page, as the shards are not ordered.
+func (kv *MemoryStore) Scan(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	limit = scanLimit(limit)
+	now := kv.now()
+	keys := []string{}
+	for i := range kv.shards {
+		s := &kv.shards[i]
+		s.mu.Lock()
+		for key, item := range s.items {
+			if key > cursor && strings.HasPrefix(key, prefix) && (item.expiresAt.IsZero() || item.expiresAt.After(now)) {
+				keys = append(keys, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+	slices.Sort(keys)
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+	keys = keys[:limit]
+	return keys, keys[limit-1], nil
+}
+
+func (kv *MemoryStore) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	now := kv.now()
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		s := kv.shard(key)
+		if item := s.get(key, now); item != nil {
+			values[key] = item.value
+		}
+		s.mu.Unlock()
+	}
+	return values, nil
+}
+
+// MSet locks the shards of all keys, in the order of the shards to avoid deadlocks, so that the keys are set at once.
+func (kv *MemoryStore) MSet(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	var locked [memoryShards]bool
+	for key := range entries {
+		locked[shardIndex(key)] = true
+	}
+	for i := range kv.shards {
+		if locked[i] {
+			kv.shards[i].mu.Lock()
+			defer kv.shards[i].mu.Unlock()
+		}
+	}
+	expiresAt := kv.expiresAt(ttl)
+	for key, value := range entries {
+		kv.shards[shardIndex(key)].set(key, value, expiresAt)
+	}
+	return nil
+}
+
+func (kv *MemoryStore) MDelete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		kv.Delete(ctx, key)
+	}
+	return nil
+}
+
+func (kv *MemoryStore) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	now := kv.now()
+	var n int64
+	for i := range kv.shards {
+		s := &kv.shards[i]
+		s.mu.Lock()
+		for key := range s.items {
+			// Expired keys are deleted by get without being counted.
+			if strings.HasPrefix(key, prefix) && s.get(key, now) != nil {
+				s.delete(s.items[key])
+				n++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+func (kv *MemoryStore) Namespace(name string) Store {
+	return newNamespace(kv, "", name)
+}
+
+func (kv *MemoryStore) Purge(ctx context.Context) (int64, error) {
+	now := kv.now()
+	var n int64
+	for i := range kv.shards {
+		s := &kv.shards[i]
+		s.mu.Lock()
+		for len(s.expiries) > 0 && !s.expiries[0].expiresAt.After(now) {
+			s.delete(s.expiries[0])
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+func (kv *MemoryStore) Close() error {
+	for i := range kv.shards {
+		s := &kv.shards[i]
+		s.mu.Lock()
+		s.items = map[string]*memoryItem{}
+		s.expiries = nil
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// expiryHeap is a min-heap of items by expiry, implementing heap.Interface.
+type expiryHeap []*memoryItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*memoryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*h = old[:len(old)-1]
+	return item
+}
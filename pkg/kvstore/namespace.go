@@ -0,0 +1,121 @@
+package kvstore
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// namespace is a Store whose keys are stored in another store with a prefix.
+type namespace struct {
+	store  Store
+	prefix string
+}
+
+func newNamespace(store Store, prefix string, name string) *namespace {
+	return &namespace{store: store, prefix: prefix + name + ":"}
+}
+
+func (ns *namespace) prefixed(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = ns.prefix + key
+	}
+	return prefixed
+}
+
+func (ns *namespace) Get(ctx context.Context, key string) (string, error) {
+	return ns.store.Get(ctx, ns.prefix+key)
+}
+
+func (ns *namespace) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return ns.store.Set(ctx, ns.prefix+key, value, ttl)
+}
+
+func (ns *namespace) Delete(ctx context.Context, key string) error {
+	return ns.store.Delete(ctx, ns.prefix+key)
+}
+
+func (ns *namespace) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return ns.store.TTL(ctx, ns.prefix+key)
+}
+
+func (ns *namespace) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return ns.store.Expire(ctx, ns.prefix+key, ttl)
+}
+
+func (ns *namespace) Persist(ctx context.Context, key string) error {
+	return ns.store.Persist(ctx, ns.prefix+key)
+}
+
+func (ns *namespace) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return ns.store.Incr(ctx, ns.prefix+key, ttl)
+}
+
+func (ns *namespace) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return ns.store.IncrBy(ctx, ns.prefix+key, delta, ttl)
+}
+
+func (ns *namespace) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return ns.store.SetNX(ctx, ns.prefix+key, value, ttl)
+}
+
+func (ns *namespace) GetDel(ctx context.Context, key string) (string, error) {
+	return ns.store.GetDel(ctx, ns.prefix+key)
+}
+
+func (ns *namespace) CompareAndSwap(ctx context.Context, key string, old string, new string) (bool, error) {
+	return ns.store.CompareAndSwap(ctx, ns.prefix+key, old, new)
+}
+
+// Scan passes the cursor through unchanged, as it is opaque to callers.
+func (ns *namespace) Scan(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	keys, next, err := ns.store.Scan(ctx, ns.prefix+prefix, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, ns.prefix)
+	}
+	return keys, next, nil
+}
+
+func (ns *namespace) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	values, err := ns.store.MGet(ctx, ns.prefixed(keys)...)
+	if err != nil {
+		return nil, err
+	}
+	unprefixed := make(map[string]string, len(values))
+	for key, value := range values {
+		unprefixed[strings.TrimPrefix(key, ns.prefix)] = value
+	}
+	return unprefixed, nil
+}
+
+func (ns *namespace) MSet(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	prefixed := make(map[string]string, len(entries))
+	for key, value := range entries {
+		prefixed[ns.prefix+key] = value
+	}
+	return ns.store.MSet(ctx, prefixed, ttl)
+}
+
+func (ns *namespace) MDelete(ctx context.Context, keys ...string) error {
+	return ns.store.MDelete(ctx, ns.prefixed(keys)...)
+}
+
+func (ns *namespace) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	return ns.store.DeletePrefix(ctx, ns.prefix+prefix)
+}
+
+func (ns *namespace) Namespace(name string) Store {
+	return newNamespace(ns.store, ns.prefix, name)
+}
+
+func (ns *namespace) Purge(ctx context.Context) (int64, error) {
+	return ns.store.Purge(ctx)
+}
+
+func (ns *namespace) Close() error {
+	return nil
+}
@@ -0,0 +1,542 @@
+package kvstore
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisPoolSize = 10
+	defaultRedisTimeout  = time.Second * 5
+)
+
+type redisOpts struct {
+	password string
+	db       int
+	poolSize int
+	timeout  time.Duration
+}
+
+// WithRedisPassword authenticates connections with the password.
+func WithRedisPassword(password string) func(*redisOpts) {
+	return func(ro *redisOpts) {
+		ro.password = password
+	}
+}
+
+// WithRedisDB selects the numbered database. The default is 0.
+func WithRedisDB(db int) func(*redisOpts) {
+	return func(ro *redisOpts) {
+		ro.db = db
+	}
+}
+
+// WithRedisPoolSize sets how many idle connections are kept open. The default is 10.
+func WithRedisPoolSize(n int) func(*redisOpts) {
+	return func(ro *redisOpts) {
+		ro.poolSize = n
+	}
+}
+
+// WithRedisTimeout sets the timeout of dialing and of commands whose context has no deadline. The default is 5 seconds.
+func WithRedisTimeout(d time.Duration) func(*redisOpts) {
+	return func(ro *redisOpts) {
+		ro.timeout = d
+	}
+}
+
+// RedisStore is a Store in a server speaking the Redis protocol, such as Redis or Valkey, so that keys are shared across instances. The server expires keys by itself. It needs Redis 6.2 or later.
+type RedisStore struct {
+	addr string
+	opts redisOpts
+
+	mu     sync.Mutex
+	idle   []*redisConn
+	closed bool
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// NewRedis returns a store in the server at `addr` (host:port). Connections are opened when needed, so the server does not need to be up yet.
+func NewRedis(addr string, optFuncs ...func(*redisOpts)) *RedisStore {
+	opts := redisOpts{poolSize: defaultRedisPoolSize, timeout: defaultRedisTimeout}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return &RedisStore{addr: addr, opts: opts}
+}
+
+// Ping checks that the server is reachable.
+func (kv *RedisStore) Ping(ctx context.Context) error {
+	_, err := kv.do(ctx, "PING")
+	return err
+}
+
+func (kv *RedisStore) dial(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: kv.opts.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", kv.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	var setup [][]string
+	if kv.opts.password != "" {
+		setup = append(setup, []string{"AUTH", kv.opts.password})
+	}
+	if kv.opts.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(kv.opts.db)})
+	}
+	if len(setup) > 0 {
+		if err = kv.setDeadline(ctx, c); err == nil {
+			_, err = c.do(setup...)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (kv *RedisStore) setDeadline(ctx context.Context, c *redisConn) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(kv.opts.timeout)
+	}
+	return c.conn.SetDeadline(deadline)
+}
+
+// withConn runs `fn` with a connection from the pool. Connections are discarded after network and protocol errors, as their state is unknown.
+func (kv *RedisStore) withConn(ctx context.Context, fn func(c *redisConn) error) error {
+	kv.mu.Lock()
+	if kv.closed {
+		kv.mu.Unlock()
+		return net.ErrClosed
+	}
+	var c *redisConn
+	if n := len(kv.idle); n > 0 {
+		c = kv.idle[n-1]
+		kv.idle = kv.idle[:n-1]
+	}
+	kv.mu.Unlock()
+
+	if c == nil {
+		var err error
+		if c, err = kv.dial(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := kv.setDeadline(ctx, c)
+	if err == nil {
+		err = fn(c)
+	}
+
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) && !errors.Is(err, ErrKeyNotFound) && !errors.Is(err, ErrNotInteger) {
+		c.conn.Close()
+		return err
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if kv.closed || len(kv.idle) >= kv.opts.poolSize {
+		c.conn.Close()
+	} else {
+		kv.idle = append(kv.idle, c)
+	}
+	return err
+}
+
+// do sends the commands at once and returns their replies. Error replies are returned as errors, after all replies have been read.
+func (c *redisConn) do(cmds ...[]string) ([]any, error) {
+	for _, cmd := range cmds {
+		if err := writeCommand(c.w, cmd...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(cmds))
+	var replyErr error
+	for i := range replies {
+		reply, err := readReply(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := reply.(RedisError); ok && replyErr == nil {
+			replyErr = e
+		}
+		replies[i] = reply
+	}
+	return replies, replyErr
+}
+
+// do runs a command and returns its reply.
+func (kv *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	var reply any
+	err := kv.withConn(ctx, func(c *redisConn) error {
+		replies, err := c.do(args)
+		if err != nil {
+			return err
+		}
+		reply = replies[0]
+		return nil
+	})
+	return reply, err
+}
+
+// transaction runs the commands in a MULTI/EXEC transaction and returns their replies.
+func (c *redisConn) transaction(cmds ...[]string) ([]any, error) {
+	replies, err := c.do(append(append([][]string{{"MULTI"}}, cmds...), []string{"EXEC"})...)
+	if err != nil {
+		return nil, err
+	}
+	// A nil EXEC reply means that the transaction was aborted, because a watched key changed.
+	results, _ := replies[len(replies)-1].([]any)
+	for _, result := range results {
+		if e, ok := result.(RedisError); ok {
+			return nil, e
+		}
+	}
+	return results, nil
+}
+
+// pxArgs returns the arguments of SET that make a key expire after `ttl`, if positive.
+func pxArgs(ttl time.Duration) []string {
+	if ttl <= 0 {
+		return nil
+	}
+	return []string{"PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)}
+}
+
+// notInteger translates the error of incrementing a value that is not an integer.
+func notInteger(err error) error {
+	var redisErr RedisError
+	if errors.As(err, &redisErr) && strings.Contains(string(redisErr), "not an integer") {
+		return ErrNotInteger
+	}
+	return err
+}
+
+func (kv *RedisStore) Get(ctx context.Context, key string) (string, error) {
+	reply, err := kv.do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return value, nil
+}
+
+func (kv *RedisStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	_, err := kv.do(ctx, append([]string{"SET", key, value}, pxArgs(ttl)...)...)
+	return err
+}
+
+func (kv *RedisStore) Delete(ctx context.Context, key string) error {
+	_, err := kv.do(ctx, "DEL", key)
+	return err
+}
+
+func (kv *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	reply, err := kv.do(ctx, "PTTL", key)
+	if err != nil {
+		return 0, err
+	}
+	switch ms, _ := reply.(int64); ms {
+	case -2:
+		return 0, ErrKeyNotFound
+	case -1:
+		return NoExpiry, nil
+	default:
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
+
+func (kv *RedisStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	args := []string{"DEL", key}
+	if ttl > 0 {
+		args = []string{"PEXPIRE", key, strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)}
+	}
+	reply, err := kv.do(ctx, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (kv *RedisStore) Persist(ctx context.Context, key string) error {
+	// PERSIST replies 0 both for missing keys and for keys without expiry, so EXISTS tells them apart.
+	return kv.withConn(ctx, func(c *redisConn) error {
+		replies, err := c.do([]string{"PERSIST", key}, []string{"EXISTS", key})
+		if err != nil {
+			return err
+		}
+		if n, _ := replies[1].(int64); n == 0 {
+			return ErrKeyNotFound
+		}
+		return nil
+	})
+}
+
+func (kv *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return kv.IncrBy(ctx, key, 1, ttl)
+}
+
+func (kv *RedisStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var n int64
+	err := kv.withConn(ctx, func(c *redisConn) error {
+		incrBy := []string{"INCRBY", key, strconv.FormatInt(delta, 10)}
+		if ttl <= 0 {
+			replies, err := c.do(incrBy)
+			if err != nil {
+				return notInteger(err)
+			}
+			n, _ = replies[0].(int64)
+			return nil
+		}
+		// Creating the key with its expiry and incrementing it in a transaction sets the expiry only when the key is created.
+		results, err := c.transaction(append([]string{"SET", key, "0", "NX"}, pxArgs(ttl)...), incrBy)
+		if err != nil {
+			return notInteger(err)
+		}
+		if len(results) != 2 {
+			return errInvalidReply
+		}
+		n, _ = results[1].(int64)
+		return nil
+	})
+	return n, err
+}
+
+func (kv *RedisStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	reply, err := kv.do(ctx, append([]string{"SET", key, value, "NX"}, pxArgs(ttl)...)...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (kv *RedisStore) GetDel(ctx context.Context, key string) (string, error) {
+	reply, err := kv.do(ctx, "GETDEL", key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return value, nil
+}
+
+func (kv *RedisStore) CompareAndSwap(ctx context.Context, key string, old string, new string) (bool, error) {
+	var swapped bool
+	err := kv.withConn(ctx, func(c *redisConn) (err error) {
+		// Connections are returned to the pool after error replies, which must not leave the key watched. On other errors, the connection is closed.
+		defer func() {
+			var redisErr RedisError
+			if errors.As(err, &redisErr) {
+				if _, unwatchErr := c.do([]string{"UNWATCH"}); unwatchErr != nil {
+					err = unwatchErr
+				}
+			}
+		}()
+		// Optimistic locking: the transaction is aborted if the key changes after WATCH, in which case the value is compared again.
+		for {
+			replies, err := c.do([]string{"WATCH", key}, []string{"GET", key})
+			if err != nil {
+				return err
+			}
+			if value, ok := replies[1].(string); !ok || value != old {
+				_, err = c.do([]string{"UNWATCH"})
+				return err
+			}
+			results, err := c.transaction([]string{"SET", key, new, "KEEPTTL"})
+			if err != nil {
+				return err
+			}
+			if results != nil {
+				swapped = true
+				return nil
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+	})
+	return swapped, err
+}
+
+// matchPrefix returns the pattern of SCAN MATCH that matches the keys starting with `prefix`.
+func matchPrefix(prefix string) string {
+	var b strings.Builder
+	for _, r := range prefix {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('*')
+	return b.String()
+}
+
+// scan runs SCAN from `cursor`, where the first and last cursors are "0".
+func (c *redisConn) scan(prefix string, cursor string, count int) ([]string, string, error) {
+	replies, err := c.do([]string{"SCAN", cursor, "MATCH", matchPrefix(prefix), "COUNT", strconv.Itoa(count)})
+	if err != nil {
+		return nil, "", err
+	}
+	reply, _ := replies[0].([]any)
+	if len(reply) != 2 {
+		return nil, "", errInvalidReply
+	}
+	next, _ := reply[0].(string)
+	items, _ := reply[1].([]any)
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		if key, ok := item.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, next, nil
+}
+
+// Scan uses SCAN, whose cursors are numbers, with `limit` as its COUNT hint.
+func (kv *RedisStore) Scan(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	if cursor == "" {
+		cursor = "0"
+	}
+	var keys []string
+	err := kv.withConn(ctx, func(c *redisConn) error {
+		var err error
+		keys, cursor, err = c.scan(prefix, cursor, scanLimit(limit))
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if cursor == "0" {
+		cursor = ""
+	}
+	return keys, cursor, nil
+}
+
+func (kv *RedisStore) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	values := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	reply, err := kv.do(ctx, append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	if len(items) != len(keys) {
+		return nil, errInvalidReply
+	}
+	for i, item := range items {
+		if value, ok := item.(string); ok {
+			values[keys[i]] = value
+		}
+	}
+	return values, nil
+}
+
+// MSet uses MSET for keys that do not expire, and a transaction of SET commands otherwise, as MSET cannot set expiries.
+func (kv *RedisStore) MSet(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if ttl <= 0 {
+		args := []string{"MSET"}
+		for key, value := range entries {
+			args = append(args, key, value)
+		}
+		_, err := kv.do(ctx, args...)
+		return err
+	}
+	cmds := make([][]string, 0, len(entries))
+	for key, value := range entries {
+		cmds = append(cmds, append([]string{"SET", key, value}, pxArgs(ttl)...))
+	}
+	return kv.withConn(ctx, func(c *redisConn) error {
+		_, err := c.transaction(cmds...)
+		return err
+	})
+}
+
+func (kv *RedisStore) MDelete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := kv.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// DeletePrefix scans the keys and deletes them page by page.
+func (kv *RedisStore) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	var n int64
+	err := kv.withConn(ctx, func(c *redisConn) error {
+		cursor := "0"
+		for {
+			keys, next, err := c.scan(prefix, cursor, 1000)
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				replies, err := c.do(append([]string{"DEL"}, keys...))
+				if err != nil {
+					return err
+				}
+				deleted, _ := replies[0].(int64)
+				n += deleted
+			}
+			if cursor = next; cursor == "0" {
+				return nil
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+		}
+	})
+	return n, err
+}
+
+func (kv *RedisStore) Namespace(name string) Store {
+	return newNamespace(kv, "", name)
+}
+
+func (kv *RedisStore) Purge(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (kv *RedisStore) Close() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.closed = true
+	var errList []error
+	for _, c := range kv.idle {
+		if err := c.conn.Close(); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	kv.idle = nil
+	return errors.Join(errList...)
+}
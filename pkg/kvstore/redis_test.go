@@ -0,0 +1,424 @@
+package kvstore_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+// redisStandIn is a server speaking the Redis protocol, implementing the commands used by RedisStore, so that it can be tested without Redis. Keys expire on the fake clock.
+type redisStandIn struct {
+	ln       net.Listener
+	now      func() time.Time
+	password string
+
+	mu       sync.Mutex
+	sessions map[*redisSession]bool
+	entries  map[string]redisEntry
+	// versions is incremented on every write of a key, so that EXEC can tell whether a watched key changed.
+	versions map[string]uint64
+}
+
+type redisEntry struct {
+	value     string
+	expiresAt time.Time
+	// hash marks entries that are not strings, on which GET fails.
+	hash bool
+}
+
+// redisSession is the state of a connection.
+type redisSession struct {
+	authed  bool
+	watched map[string]uint64
+	inMulti bool
+	queued  [][]string
+}
+
+func newRedisStandIn(t *testing.T, now func() time.Time, password string) *redisStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &redisStandIn{ln: ln, now: now, password: password, sessions: map[*redisSession]bool{}, entries: map[string]redisEntry{}, versions: map[string]uint64{}}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *redisStandIn) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *redisStandIn) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *redisStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	session := &redisSession{authed: s.password == ""}
+	s.mu.Lock()
+	s.sessions[session] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, session)
+		s.mu.Unlock()
+	}()
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		w.WriteString(s.run(session, cmd))
+		// Replies of pipelined commands are flushed together.
+		if r.Buffered() == 0 {
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// watching returns the number of connections watching keys.
+func (s *redisStandIn) watching() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for session := range s.sessions {
+		if len(session.watched) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "*"), "\r\n"))
+	if err != nil || n < 1 {
+		return nil, errors.New("invalid command")
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "$"), "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func simpleReply(s string) string { return "+" + s + "\r\n" }
+
+func errorReply(s string) string { return "-" + s + "\r\n" }
+
+func intReply(n int64) string { return ":" + strconv.FormatInt(n, 10) + "\r\n" }
+
+func bulkReply(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+const nilReply = "$-1\r\n"
+
+func (s *redisStandIn) run(session *redisSession, cmd []string) string {
+	name := strings.ToUpper(cmd[0])
+	if name == "AUTH" {
+		if len(cmd) != 2 || cmd[1] != s.password {
+			return errorReply("WRONGPASS invalid password")
+		}
+		session.authed = true
+		return simpleReply("OK")
+	}
+	if !session.authed {
+		return errorReply("NOAUTH Authentication required.")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch name {
+	case "MULTI":
+		session.inMulti = true
+		return simpleReply("OK")
+	case "DISCARD":
+		session.inMulti, session.queued, session.watched = false, nil, nil
+		return simpleReply("OK")
+	case "EXEC":
+		queued, watched := session.queued, session.watched
+		session.inMulti, session.queued, session.watched = false, nil, nil
+		for key, version := range watched {
+			if s.versions[key] != version {
+				return "*-1\r\n"
+			}
+		}
+		reply := fmt.Sprintf("*%d\r\n", len(queued))
+		for _, cmd := range queued {
+			reply += s.exec(session, cmd)
+		}
+		return reply
+	}
+	if session.inMulti {
+		session.queued = append(session.queued, cmd)
+		return simpleReply("QUEUED")
+	}
+	return s.exec(session, cmd)
+}
+
+// get returns the entry of the key, deleting it if it has expired. The caller must hold the lock.
+func (s *redisStandIn) get(key string) (redisEntry, bool) {
+	e, ok := s.entries[key]
+	if ok && !e.expiresAt.IsZero() && !e.expiresAt.After(s.now()) {
+		s.del(key)
+		return redisEntry{}, false
+	}
+	return e, ok
+}
+
+func (s *redisStandIn) put(key string, e redisEntry) {
+	s.entries[key] = e
+	s.versions[key]++
+}
+
+func (s *redisStandIn) del(key string) bool {
+	if _, ok := s.entries[key]; !ok {
+		return false
+	}
+	delete(s.entries, key)
+	s.versions[key]++
+	return true
+}
+
+func (s *redisStandIn) exec(session *redisSession, cmd []string) string {
+	args := cmd[1:]
+	switch strings.ToUpper(cmd[0]) {
+	case "PING":
+		return simpleReply("PONG")
+	case "SELECT":
+		return simpleReply("OK")
+	case "WATCH":
+		if session.watched == nil {
+			session.watched = map[string]uint64{}
+		}
+		for _, key := range args {
+			session.watched[key] = s.versions[key]
+		}
+		return simpleReply("OK")
+	case "UNWATCH":
+		session.watched = nil
+		return simpleReply("OK")
+	case "GET":
+		e, ok := s.get(args[0])
+		if !ok {
+			return nilReply
+		}
+		if e.hash {
+			return errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		return bulkReply(e.value)
+	case "GETDEL":
+		e, ok := s.get(args[0])
+		if !ok {
+			return nilReply
+		}
+		s.del(args[0])
+		return bulkReply(e.value)
+	case "SET":
+		key, e := args[0], redisEntry{value: args[1]}
+		old, exists := s.get(key)
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if exists {
+					return nilReply
+				}
+			case "KEEPTTL":
+				e.expiresAt = old.expiresAt
+			case "PX":
+				i++
+				ms, err := strconv.ParseInt(args[i], 10, 64)
+				if err != nil || ms <= 0 {
+					return errorReply("ERR invalid expire time in 'set' command")
+				}
+				e.expiresAt = s.now().Add(time.Duration(ms) * time.Millisecond)
+			default:
+				return errorReply("ERR syntax error")
+			}
+		}
+		s.put(key, e)
+		return simpleReply("OK")
+	case "MGET":
+		reply := fmt.Sprintf("*%d\r\n", len(args))
+		for _, key := range args {
+			if e, ok := s.get(key); ok {
+				reply += bulkReply(e.value)
+			} else {
+				reply += nilReply
+			}
+		}
+		return reply
+	case "MSET":
+		for i := 0; i+1 < len(args); i += 2 {
+			s.put(args[i], redisEntry{value: args[i+1]})
+		}
+		return simpleReply("OK")
+	case "SCAN":
+		// The cursor is the offset in the sorted keys. Only patterns matching a prefix are supported.
+		offset, _ := strconv.Atoi(args[0])
+		prefix, count := "", 10
+		for i := 1; i+1 < len(args); i += 2 {
+			switch strings.ToUpper(args[i]) {
+			case "MATCH":
+				prefix = strings.NewReplacer(`\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]", `\\`, `\`).Replace(strings.TrimSuffix(args[i+1], "*"))
+			case "COUNT":
+				count, _ = strconv.Atoi(args[i+1])
+			}
+		}
+		keys := slices.Sorted(maps.Keys(s.entries))
+		end := min(offset+count, len(keys))
+		var matched []string
+		// Expired keys are skipped but not deleted, which would shift the offsets of the next pages.
+		for _, key := range keys[min(offset, end):end] {
+			if e := s.entries[key]; (e.expiresAt.IsZero() || e.expiresAt.After(s.now())) && strings.HasPrefix(key, prefix) {
+				matched = append(matched, key)
+			}
+		}
+		if end == len(keys) {
+			end = 0
+		}
+		reply := fmt.Sprintf("*2\r\n%s*%d\r\n", bulkReply(strconv.Itoa(end)), len(matched))
+		for _, key := range matched {
+			reply += bulkReply(key)
+		}
+		return reply
+	case "DEL":
+		var n int64
+		for _, key := range args {
+			if _, ok := s.get(key); ok && s.del(key) {
+				n++
+			}
+		}
+		return intReply(n)
+	case "EXISTS":
+		var n int64
+		for _, key := range args {
+			if _, ok := s.get(key); ok {
+				n++
+			}
+		}
+		return intReply(n)
+	case "PTTL":
+		e, ok := s.get(args[0])
+		switch {
+		case !ok:
+			return intReply(-2)
+		case e.expiresAt.IsZero():
+			return intReply(-1)
+		default:
+			return intReply(e.expiresAt.Sub(s.now()).Milliseconds())
+		}
+	case "PEXPIRE":
+		e, ok := s.get(args[0])
+		if !ok {
+			return intReply(0)
+		}
+		ms, _ := strconv.ParseInt(args[1], 10, 64)
+		e.expiresAt = s.now().Add(time.Duration(ms) * time.Millisecond)
+		s.put(args[0], e)
+		return intReply(1)
+	case "PERSIST":
+		e, ok := s.get(args[0])
+		if !ok || e.expiresAt.IsZero() {
+			return intReply(0)
+		}
+		e.expiresAt = time.Time{}
+		s.put(args[0], e)
+		return intReply(1)
+	case "INCRBY":
+		delta, _ := strconv.ParseInt(args[1], 10, 64)
+		e, _ := s.get(args[0])
+		n := int64(0)
+		if e.value != "" {
+			var err error
+			if n, err = strconv.ParseInt(e.value, 10, 64); err != nil {
+				return errorReply("ERR value is not an integer or out of range")
+			}
+		}
+		n += delta
+		e.value = strconv.FormatInt(n, 10)
+		s.put(args[0], e)
+		return intReply(n)
+	default:
+		return errorReply("ERR unknown command '" + cmd[0] + "'")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	clock := newClock()
+	server := newRedisStandIn(t, clock.Now, "secret")
+
+	t.Run("Authentication", func(t *testing.T) {
+		ctx := context.Background()
+		kv := kvstore.NewRedis(server.Addr(), kvstore.WithRedisPassword("wrong"))
+		defer kv.Close()
+		var redisErr kvstore.RedisError
+		assert.ErrorAs(t, kv.Ping(ctx), &redisErr)
+
+		kv = kvstore.NewRedis(server.Addr(), kvstore.WithRedisPassword("secret"), kvstore.WithRedisDB(1))
+		defer kv.Close()
+		assert.Nil(t, kv.Ping(ctx))
+	})
+
+	kv := kvstore.NewRedis(server.Addr(), kvstore.WithRedisPassword("secret"))
+	defer kv.Close()
+	testStore(t, kv, clock, false)
+
+	t.Run("Unwatch after error replies", func(t *testing.T) {
+		server.mu.Lock()
+		server.put("hash", redisEntry{hash: true})
+		server.mu.Unlock()
+		_, err := kv.CompareAndSwap(context.Background(), "hash", "old", "new")
+		var redisErr kvstore.RedisError
+		assert.ErrorAs(t, err, &redisErr)
+		// The connection is back in the pool, and must not be watching the key.
+		assert.Equal(t, 0, server.watching())
+	})
+
+	concurrent := kvstore.NewRedis(newRedisStandIn(t, time.Now, "").Addr())
+	defer concurrent.Close()
+	testStoreConcurrency(t, concurrent)
+
+	t.Run("Closed store", func(t *testing.T) {
+		kv := kvstore.NewRedis(server.Addr(), kvstore.WithRedisPassword("secret"))
+		assert.Nil(t, kv.Close())
+		assert.ErrorIs(t, kv.Set(context.Background(), "key", "value", 0), net.ErrClosed)
+	})
+}
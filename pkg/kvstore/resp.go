@@ -0,0 +1,97 @@
+package kvstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// This file implements the parts of RESP (REdis Serialization Protocol) version 2 used by RedisStore.
+
+// RedisError is an error reply of a Redis server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+var errInvalidReply = errors.New("redis: invalid reply")
+
+// writeCommand writes a command as an array of bulk strings.
+func writeCommand(w *bufio.Writer, args ...string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReply reads a reply. Simple and bulk strings are returned as string, integers as int64, arrays as []any, and null bulk strings and arrays as nil. Error replies are returned as a RedisError value, not as the error, as they do not break the connection.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errInvalidReply
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return RedisError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errInvalidReply
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, errInvalidReply
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < -1 {
+			return nil, errInvalidReply
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		array := make([]any, n)
+		for i := range array {
+			if array[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	default:
+		return nil, errInvalidReply
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errInvalidReply
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,299 @@
+package kvstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/internal/common"
+)
+
+// SqliteStore is a Store in an SQLite database, which is in memory or in a file.
+type SqliteStore struct {
+	db          *sql.DB
+	now         func() time.Time
+	getStmt     *sql.Stmt
+	setStmt     *sql.Stmt
+	deleteStmt  *sql.Stmt
+	ttlStmt     *sql.Stmt
+	expireStmt  *sql.Stmt
+	persistStmt *sql.Stmt
+	incrByStmt  *sql.Stmt
+	setNXStmt   *sql.Stmt
+	getDelStmt  *sql.Stmt
+	casStmt     *sql.Stmt
+	scanStmt    *sql.Stmt
+	mGetStmt    *sql.Stmt
+	mSetStmt    *sql.Stmt
+	mDeleteStmt *sql.Stmt
+	delPrefStmt *sql.Stmt
+}
+
+// NewSqlite creates the store in `db`, which must be an SQLite database. Use a file database for keys to survive restarts. Expired keys are not returned, and are deleted by Purge.
+func NewSqlite(db *sql.DB, optFuncs ...func(*kvOpts)) (*SqliteStore, error) {
+	opts := newKVOpts(optFuncs)
+
+	// expires_at is in unix milliseconds, and NULL for keys that do not expire.
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS kv_store(key TEXT PRIMARY KEY, value TEXT NOT NULL, expires_at INTEGER);"); err != nil {
+		return nil, err
+	}
+
+	kv := &SqliteStore{db: db, now: opts.now}
+	for _, s := range [...]struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&kv.getStmt, "SELECT value FROM kv_store WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2);"},
+		{&kv.setStmt, "INSERT INTO kv_store(key, value, expires_at) VALUES($1, $2, $3) ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at;"},
+		{&kv.deleteStmt, "DELETE FROM kv_store WHERE key = $1;"},
+		{&kv.ttlStmt, "SELECT expires_at FROM kv_store WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2);"},
+		{&kv.expireStmt, "UPDATE kv_store SET expires_at = $2 WHERE key = $1 AND (expires_at IS NULL OR expires_at > $3);"},
+		{&kv.persistStmt, "UPDATE kv_store SET expires_at = NULL WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2);"},
+		// The atomic operations are single statements, as SQLite runs each statement atomically. An expired key is treated as missing.
+		{&kv.incrByStmt, `INSERT INTO kv_store(key, value, expires_at) VALUES($1, $2, $3) ON CONFLICT(key) DO UPDATE SET
+			value = CASE WHEN kv_store.expires_at <= $4 THEN excluded.value ELSE CAST(kv_store.value AS INTEGER) + $2 END,
+			expires_at = CASE WHEN kv_store.expires_at <= $4 THEN excluded.expires_at ELSE kv_store.expires_at END
+			WHERE kv_store.expires_at <= $4 OR CAST(CAST(kv_store.value AS INTEGER) AS TEXT) = kv_store.value
+			RETURNING value;`},
+		{&kv.setNXStmt, "INSERT INTO kv_store(key, value, expires_at) VALUES($1, $2, $3) ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at WHERE kv_store.expires_at <= $4;"},
+		{&kv.getDelStmt, "DELETE FROM kv_store WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2) RETURNING value;"},
+		{&kv.casStmt, "UPDATE kv_store SET value = $3 WHERE key = $1 AND value = $2 AND (expires_at IS NULL OR expires_at > $4);"},
+		// The key >= $1 condition lets the prefix scan seek in the primary key index.
+		{&kv.scanStmt, "SELECT key FROM kv_store WHERE key >= $1 AND key > $2 AND substr(key, 1, length($1)) = $1 AND (expires_at IS NULL OR expires_at > $3) ORDER BY key LIMIT $4;"},
+		// The batch operations take the keys as a JSON array, and the entries as a JSON object, so that their statements can be prepared.
+		{&kv.mGetStmt, "SELECT key, value FROM kv_store WHERE key IN (SELECT value FROM json_each($1)) AND (expires_at IS NULL OR expires_at > $2);"},
+		// The WHERE clause tells the parser that ON CONFLICT is not part of the join.
+		{&kv.mSetStmt, "INSERT INTO kv_store(key, value, expires_at) SELECT key, value, $2 FROM json_each($1) WHERE true ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at;"},
+		{&kv.mDeleteStmt, "DELETE FROM kv_store WHERE key IN (SELECT value FROM json_each($1));"},
+		{&kv.delPrefStmt, "DELETE FROM kv_store WHERE key >= $1 AND substr(key, 1, length($1)) = $1 AND (expires_at IS NULL OR expires_at > $2);"},
+	} {
+		stmt, err := db.Prepare(s.query)
+		if err != nil {
+			return nil, err
+		}
+		*s.stmt = stmt
+	}
+	return kv, nil
+}
+
+func (kv *SqliteStore) Purge(ctx context.Context) (int64, error) {
+	res, err := kv.db.ExecContext(ctx, "DELETE FROM kv_store WHERE expires_at IS NOT NULL AND expires_at <= $1;", kv.nowMillis())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (kv *SqliteStore) Close() error {
+	var errList []error
+
+	for _, stmt := range []common.Closer{kv.getStmt, kv.setStmt, kv.deleteStmt, kv.ttlStmt, kv.expireStmt, kv.persistStmt, kv.incrByStmt, kv.setNXStmt, kv.getDelStmt, kv.casStmt, kv.scanStmt, kv.mGetStmt, kv.mSetStmt, kv.mDeleteStmt, kv.delPrefStmt, kv.db} {
+		if err := stmt.Close(); err != nil {
+			errList = append(errList, err)
+		}
+	}
+
+	return errors.Join(errList...)
+}
+
+func (kv *SqliteStore) nowMillis() int64 {
+	return kv.now().UnixMilli()
+}
+
+// expiresAt returns the expiry of a key set now with `ttl`, or nil if it does not expire.
+func (kv *SqliteStore) expiresAt(ttl time.Duration) *int64 {
+	if ttl <= 0 {
+		return nil
+	}
+	t := kv.now().Add(ttl).UnixMilli()
+	return &t
+}
+
+func (kv *SqliteStore) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	if err := kv.getStmt.QueryRowContext(ctx, key, kv.nowMillis()).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrKeyNotFound
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func (kv *SqliteStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	_, err := kv.setStmt.ExecContext(ctx, key, value, kv.expiresAt(ttl))
+	return err
+}
+
+func (kv *SqliteStore) Delete(ctx context.Context, key string) error {
+	_, err := kv.deleteStmt.ExecContext(ctx, key)
+	return err
+}
+
+func (kv *SqliteStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	now := kv.nowMillis()
+	var expiresAt sql.NullInt64
+	if err := kv.ttlStmt.QueryRowContext(ctx, key, now).Scan(&expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrKeyNotFound
+		}
+		return 0, err
+	}
+	if !expiresAt.Valid {
+		return NoExpiry, nil
+	}
+	return time.Duration(expiresAt.Int64-now) * time.Millisecond, nil
+}
+
+func (kv *SqliteStore) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		res, err := kv.db.ExecContext(ctx, "DELETE FROM kv_store WHERE key = $1 AND (expires_at IS NULL OR expires_at > $2);", key, kv.nowMillis())
+		return affectedKey(res, err)
+	}
+	return affectedKey(kv.expireStmt.ExecContext(ctx, key, kv.expiresAt(ttl), kv.nowMillis()))
+}
+
+func (kv *SqliteStore) Persist(ctx context.Context, key string) error {
+	return affectedKey(kv.persistStmt.ExecContext(ctx, key, kv.nowMillis()))
+}
+
+// affectedKey returns ErrKeyNotFound if the statement did not affect any key.
+func affectedKey(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (kv *SqliteStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return kv.IncrBy(ctx, key, 1, ttl)
+}
+
+func (kv *SqliteStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var value int64
+	if err := kv.incrByStmt.QueryRowContext(ctx, key, delta, kv.expiresAt(ttl), kv.nowMillis()).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotInteger
+		}
+		return 0, err
+	}
+	return value, nil
+}
+
+func (kv *SqliteStore) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	res, err := kv.setNXStmt.ExecContext(ctx, key, value, kv.expiresAt(ttl), kv.nowMillis())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (kv *SqliteStore) GetDel(ctx context.Context, key string) (string, error) {
+	var value string
+	if err := kv.getDelStmt.QueryRowContext(ctx, key, kv.nowMillis()).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrKeyNotFound
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func (kv *SqliteStore) CompareAndSwap(ctx context.Context, key string, old string, new string) (bool, error) {
+	res, err := kv.casStmt.ExecContext(ctx, key, old, new, kv.nowMillis())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (kv *SqliteStore) Scan(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	limit = scanLimit(limit)
+	// One more key than the limit is read to tell whether there is a next page.
+	rows, err := kv.scanStmt.QueryContext(ctx, prefix, cursor, kv.nowMillis(), limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+	keys = keys[:limit]
+	return keys, keys[limit-1], nil
+}
+
+func (kv *SqliteStore) MGet(ctx context.Context, keys ...string) (map[string]string, error) {
+	keysJson, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := kv.mGetStmt.QueryContext(ctx, string(keysJson), kv.nowMillis())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string, len(keys))
+	for rows.Next() {
+		var key, value string
+		if err = rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+func (kv *SqliteStore) MSet(ctx context.Context, entries map[string]string, ttl time.Duration) error {
+	entriesJson, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	_, err = kv.mSetStmt.ExecContext(ctx, string(entriesJson), kv.expiresAt(ttl))
+	return err
+}
+
+func (kv *SqliteStore) MDelete(ctx context.Context, keys ...string) error {
+	keysJson, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	_, err = kv.mDeleteStmt.ExecContext(ctx, string(keysJson))
+	return err
+}
+
+// DeletePrefix leaves the expired keys to Purge.
+func (kv *SqliteStore) DeletePrefix(ctx context.Context, prefix string) (int64, error) {
+	res, err := kv.delPrefStmt.ExecContext(ctx, prefix, kv.nowMillis())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (kv *SqliteStore) Namespace(name string) Store {
+	return newNamespace(kv, "", name)
+}
@@ -0,0 +1,31 @@
+package kvstore_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSqliteStore(t *testing.T) {
+	clock := newClock()
+	db, err := database.NewSqlite(":memory:")
+	assert.Nil(t, err)
+	kv, err := kvstore.NewSqlite(db, kvstore.WithClock(clock.Now))
+	assert.Nil(t, err)
+	defer kv.Close()
+	testStore(t, kv, clock, true)
+}
+
+func TestSqliteStoreConcurrency(t *testing.T) {
+	// A file database, so that the goroutines use separate connections.
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "kv.db")+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	assert.Nil(t, err)
+	kv, err := kvstore.NewSqlite(db)
+	assert.Nil(t, err)
+	defer kv.Close()
+	testStoreConcurrency(t, kv)
+}
@@ -0,0 +1,91 @@
+// Package kvstore provides key-value stores with expiring keys and atomic operations, backed by SQLite, memory or a Redis-compatible server.
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrNotInteger  = errors.New("value is not an integer")
+)
+
+// NoExpiry is the TTL of keys that do not expire.
+const NoExpiry time.Duration = -1
+
+// Store is a key-value store. Expired keys behave as if they did not exist. A zero TTL sets a key that does not expire.
+type Store interface {
+	// Get returns the value of the key. It fails with ErrKeyNotFound if the key does not exist.
+	Get(ctx context.Context, key string) (string, error)
+	// Set sets the value of the key, which expires after `ttl`.
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// TTL returns how long until the key expires, or NoExpiry if it does not expire. It fails with ErrKeyNotFound if the key does not exist.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Expire makes the key expire after `ttl`. A `ttl` that is not positive deletes the key. It fails with ErrKeyNotFound if the key does not exist.
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	// Persist removes the expiry of the key. It fails with ErrKeyNotFound if the key does not exist.
+	Persist(ctx context.Context, key string) error
+	// Incr increments the integer value of the key by one, as IncrBy.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// IncrBy adds `delta` to the integer value of the key and returns the result. A missing key is created with the value `delta`, expiring after `ttl`. Incrementing an existing key keeps its expiry, so that counters of fixed windows can be built with it. It fails with ErrNotInteger if the value is not an integer.
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// SetNX sets the key like Set, only if it does not exist. It reports whether the key was set.
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	// GetDel deletes the key and returns its value, so that only one caller gets it, as for single-use tokens. It fails with ErrKeyNotFound if the key does not exist.
+	GetDel(ctx context.Context, key string) (string, error)
+	// CompareAndSwap sets the value of the key to `new` if it is `old`, keeping its expiry. It reports whether the value was swapped, which is false if the key does not exist.
+	CompareAndSwap(ctx context.Context, key string, old string, new string) (bool, error)
+	// Scan returns up to `limit` keys that start with `prefix`, from the page at `cursor`, and the cursor of the next page. Start with an empty cursor; the next cursor is empty after the last page. A `limit` that is not positive means 100. Keys are in order, except in RedisStore, where pages may hold more or fewer keys than `limit` and a key may be returned twice if the keys change during the scan.
+	Scan(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error)
+	// MGet returns the values of the keys that exist.
+	MGet(ctx context.Context, keys ...string) (map[string]string, error)
+	// MSet sets the keys to their values at once, all expiring after `ttl`.
+	MSet(ctx context.Context, entries map[string]string, ttl time.Duration) error
+	MDelete(ctx context.Context, keys ...string) error
+	// DeletePrefix deletes the keys that start with `prefix` and returns how many there were. It is not atomic: keys set during the call may be kept.
+	DeletePrefix(ctx context.Context, prefix string) (int64, error)
+	// Namespace returns the store with the keys prefixed by `name` and a colon, so that features cannot clash on keys and a feature's keys can be scanned and deleted together. Namespaces can be nested. A namespace shares the store: its Purge purges the whole store, and its Close does nothing.
+	Namespace(name string) Store
+	// Purge deletes the expired keys and returns how many there were. Run it periodically, for example with package scheduler. Stores that expire keys by themselves return zero.
+	Purge(ctx context.Context) (int64, error)
+	Close() error
+}
+
+var (
+	_ Store = (*SqliteStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*RedisStore)(nil)
+	_ Store = (*namespace)(nil)
+)
+
+const defaultScanLimit = 100
+
+// scanLimit returns the number of keys in a page of Scan.
+func scanLimit(limit int) int {
+	if limit <= 0 {
+		return defaultScanLimit
+	}
+	return limit
+}
+
+type kvOpts struct {
+	now func() time.Time
+}
+
+// WithClock makes the store use `now` for the current time instead of time.Now, so that tests can control expiry.
+func WithClock(now func() time.Time) func(*kvOpts) {
+	return func(ko *kvOpts) {
+		ko.now = now
+	}
+}
+
+func newKVOpts(optFuncs []func(*kvOpts)) kvOpts {
+	opts := kvOpts{now: time.Now}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return opts
+}
@@ -0,0 +1,366 @@
+package kvstore_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a fake clock for testing expiry. It is safe for concurrent use, as stores may read it from other goroutines.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestMemoryStore(t *testing.T) {
+	clock := newClock()
+	kv := kvstore.NewMemory(kvstore.WithClock(clock.Now))
+	defer kv.Close()
+	testStore(t, kv, clock, true)
+
+	concurrent := kvstore.NewMemory()
+	defer concurrent.Close()
+	testStoreConcurrency(t, concurrent)
+}
+
+// testStore tests the behaviour that all stores share. The store must use the clock. Stores that expire keys by themselves do not report purged keys, so `purges` tells whether Purge is tested.
+func testStore(t *testing.T, kv kvstore.Store, clock *clock, purges bool) {
+	ctx := context.Background()
+
+	t.Run("Set key", func(t *testing.T) {
+		assert.Nil(t, kv.Set(ctx, "key", "value", 0))
+
+		value, err := kv.Get(ctx, "key")
+		assert.Nil(t, err)
+		assert.Equal(t, "value", value)
+
+		ttl, err := kv.TTL(ctx, "key")
+		assert.Nil(t, err)
+		assert.Equal(t, kvstore.NoExpiry, ttl)
+	})
+
+	t.Run("Delete key", func(t *testing.T) {
+		assert.Nil(t, kv.Delete(ctx, "key"))
+
+		value, err := kv.Get(ctx, "key")
+		assert.Equal(t, "", value)
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+
+		_, err = kv.TTL(ctx, "key")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		assert.Nil(t, kv.Set(ctx, "expiring", "value", time.Minute))
+
+		clock.Advance(time.Second * 20)
+		ttl, err := kv.TTL(ctx, "expiring")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Second*40, ttl)
+
+		clock.Advance(time.Second * 40)
+		_, err = kv.Get(ctx, "expiring")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+		assert.ErrorIs(t, kv.Expire(ctx, "expiring", time.Minute), kvstore.ErrKeyNotFound)
+		assert.ErrorIs(t, kv.Persist(ctx, "expiring"), kvstore.ErrKeyNotFound)
+
+		// Setting an expired key sets it again.
+		assert.Nil(t, kv.Set(ctx, "expiring", "new value", time.Minute))
+		value, err := kv.Get(ctx, "expiring")
+		assert.Nil(t, err)
+		assert.Equal(t, "new value", value)
+	})
+
+	t.Run("Expire and persist", func(t *testing.T) {
+		assert.Nil(t, kv.Set(ctx, "persisted", "value", 0))
+		assert.Nil(t, kv.Expire(ctx, "persisted", time.Hour))
+		ttl, err := kv.TTL(ctx, "persisted")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Hour, ttl)
+
+		assert.Nil(t, kv.Persist(ctx, "persisted"))
+		clock.Advance(time.Hour * 2)
+		ttl, err = kv.TTL(ctx, "persisted")
+		assert.Nil(t, err)
+		assert.Equal(t, kvstore.NoExpiry, ttl)
+
+		// A ttl that is not positive deletes the key.
+		assert.Nil(t, kv.Expire(ctx, "persisted", 0))
+		_, err = kv.Get(ctx, "persisted")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+		assert.ErrorIs(t, kv.Expire(ctx, "missing", time.Hour), kvstore.ErrKeyNotFound)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		assert.Nil(t, kv.Set(ctx, "short", "value", time.Second))
+		assert.Nil(t, kv.Set(ctx, "long", "value", time.Hour))
+		assert.Nil(t, kv.Set(ctx, "forever", "value", 0))
+
+		clock.Advance(time.Minute)
+		// The key "expiring" from the expiry test has expired as well.
+		n, err := kv.Purge(ctx)
+		assert.Nil(t, err)
+		if purges {
+			assert.Equal(t, int64(2), n)
+		}
+		_, err = kv.Get(ctx, "short")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+
+		for _, key := range [...]string{"long", "forever"} {
+			_, err := kv.Get(ctx, key)
+			assert.Nil(t, err, key)
+		}
+	})
+
+	t.Run("Incr", func(t *testing.T) {
+		n, err := kv.Incr(ctx, "counter", time.Minute)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+
+		clock.Advance(time.Second * 30)
+		n, err = kv.IncrBy(ctx, "counter", -5, time.Hour)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(-4), n)
+		// The ttl only applies when the key is created.
+		ttl, err := kv.TTL(ctx, "counter")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Second*30, ttl)
+
+		clock.Advance(time.Second * 30)
+		n, err = kv.IncrBy(ctx, "counter", 2, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), n)
+		ttl, err = kv.TTL(ctx, "counter")
+		assert.Nil(t, err)
+		assert.Equal(t, kvstore.NoExpiry, ttl)
+
+		assert.Nil(t, kv.Set(ctx, "text", "abc", 0))
+		_, err = kv.Incr(ctx, "text", 0)
+		assert.ErrorIs(t, err, kvstore.ErrNotInteger)
+		value, err := kv.Get(ctx, "text")
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", value)
+	})
+
+	t.Run("SetNX", func(t *testing.T) {
+		ok, err := kv.SetNX(ctx, "lock", "a", time.Minute)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+
+		ok, err = kv.SetNX(ctx, "lock", "b", time.Minute)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		clock.Advance(time.Minute)
+		ok, err = kv.SetNX(ctx, "lock", "c", 0)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		value, err := kv.Get(ctx, "lock")
+		assert.Nil(t, err)
+		assert.Equal(t, "c", value)
+	})
+
+	t.Run("GetDel", func(t *testing.T) {
+		assert.Nil(t, kv.Set(ctx, "token", "user", time.Minute))
+		value, err := kv.GetDel(ctx, "token")
+		assert.Nil(t, err)
+		assert.Equal(t, "user", value)
+
+		_, err = kv.GetDel(ctx, "token")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+
+		assert.Nil(t, kv.Set(ctx, "token", "user", time.Minute))
+		clock.Advance(time.Minute)
+		_, err = kv.GetDel(ctx, "token")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		assert.Nil(t, kv.Set(ctx, "state", "old", time.Minute))
+		swapped, err := kv.CompareAndSwap(ctx, "state", "other", "new")
+		assert.Nil(t, err)
+		assert.False(t, swapped)
+
+		swapped, err = kv.CompareAndSwap(ctx, "state", "old", "new")
+		assert.Nil(t, err)
+		assert.True(t, swapped)
+		value, err := kv.Get(ctx, "state")
+		assert.Nil(t, err)
+		assert.Equal(t, "new", value)
+		ttl, err := kv.TTL(ctx, "state")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Minute, ttl)
+
+		swapped, err = kv.CompareAndSwap(ctx, "missing", "", "new")
+		assert.Nil(t, err)
+		assert.False(t, swapped)
+	})
+	t.Run("Namespace", func(t *testing.T) {
+		sessions := kv.Namespace("sessions")
+		assert.Nil(t, sessions.Set(ctx, "a", "1", 0))
+		value, err := kv.Get(ctx, "sessions:a")
+		assert.Nil(t, err)
+		assert.Equal(t, "1", value)
+		_, err = sessions.Get(ctx, "sessions:a")
+		assert.ErrorIs(t, err, kvstore.ErrKeyNotFound)
+
+		assert.Nil(t, sessions.Namespace("user").Set(ctx, "b", "2", 0))
+		value, err = kv.Get(ctx, "sessions:user:b")
+		assert.Nil(t, err)
+		assert.Equal(t, "2", value)
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		batch := kv.Namespace("batch")
+		assert.Nil(t, batch.MSet(ctx, map[string]string{"a": "1", "b": "2", "c": "3"}, time.Minute))
+		values, err := batch.MGet(ctx, "a", "c", "missing")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"a": "1", "c": "3"}, values)
+		ttl, err := batch.TTL(ctx, "b")
+		assert.Nil(t, err)
+		assert.Equal(t, time.Minute, ttl)
+
+		assert.Nil(t, batch.MDelete(ctx, "a", "b"))
+		values, err = batch.MGet(ctx, "a", "b", "c")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"c": "3"}, values)
+
+		values, err = batch.MGet(ctx)
+		assert.Nil(t, err)
+		assert.Empty(t, values)
+		assert.Nil(t, batch.MDelete(ctx))
+
+		clock.Advance(time.Minute)
+		values, err = batch.MGet(ctx, "c")
+		assert.Nil(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		scan := kv.Namespace("scan")
+		entries := map[string]string{"other": "1"}
+		for i := range 25 {
+			entries[fmt.Sprintf("user:%02d", i)] = "1"
+		}
+		assert.Nil(t, scan.MSet(ctx, entries, 0))
+		assert.Nil(t, scan.Set(ctx, "user:expired", "1", time.Second))
+		clock.Advance(time.Second)
+
+		keys := scanAll(t, scan, "user:")
+		assert.Len(t, keys, 25)
+		assert.Equal(t, "user:00", keys[0])
+		assert.Equal(t, "user:24", keys[24])
+	})
+
+	t.Run("DeletePrefix", func(t *testing.T) {
+		scan := kv.Namespace("scan")
+		n, err := scan.DeletePrefix(ctx, "user:")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(25), n)
+		assert.Equal(t, []string{"other"}, scanAll(t, scan, ""))
+
+		// Characters with a meaning in patterns match themselves.
+		glob := kv.Namespace("glob")
+		assert.Nil(t, glob.MSet(ctx, map[string]string{"a*b": "1", "a*c": "1", "ab": "1", `a\`: "1"}, 0))
+		n, err = glob.DeletePrefix(ctx, "a*")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Equal(t, []string{`a\`, "ab"}, scanAll(t, glob, ""))
+	})
+}
+
+// scanAll returns the sorted keys that start with `prefix`, scanning page by page.
+func scanAll(t *testing.T, kv kvstore.Store, prefix string) []string {
+	var keys []string
+	cursor := ""
+	for {
+		page, next, err := kv.Scan(context.Background(), prefix, cursor, 10)
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		assert.LessOrEqual(t, len(page), 10)
+		keys = append(keys, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// testStoreConcurrency tests that the atomic operations are atomic when run concurrently.
+func testStoreConcurrency(t *testing.T, kv kvstore.Store) {
+	ctx := context.Background()
+
+	const workers, iterations = 20, 25
+	assert.Nil(t, kv.Set(ctx, "cas", "0", 0))
+
+	var wg sync.WaitGroup
+	var setNXWins, getDelWins atomic.Int32
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				_, err := kv.Incr(ctx, "counter", 0)
+				assert.Nil(t, err)
+
+				// Increment using compare-and-swap, retrying on conflicts.
+				for {
+					value, err := kv.Get(ctx, "cas")
+					assert.Nil(t, err)
+					n, _ := strconv.Atoi(value)
+					swapped, err := kv.CompareAndSwap(ctx, "cas", value, strconv.Itoa(n+1))
+					assert.Nil(t, err)
+					if swapped {
+						break
+					}
+				}
+			}
+			if ok, err := kv.SetNX(ctx, "once", "1", 0); err == nil && ok {
+				setNXWins.Add(1)
+			}
+			if _, err := kv.GetDel(ctx, "once"); err == nil {
+				getDelWins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := kv.IncrBy(ctx, "counter", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(workers*iterations), n)
+
+	value, err := kv.Get(ctx, "cas")
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(workers*iterations), value)
+
+	// Each value set is deleted by exactly one GetDel.
+	assert.Equal(t, setNXWins.Load(), getDelWins.Load())
+	assert.Positive(t, setNXWins.Load())
+}
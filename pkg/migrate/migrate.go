@@ -0,0 +1,338 @@
+// Package migrate provides a runner for versioned SQL migrations.
+//
+// Migrations are read from a filesystem with files named `<version>_<name>.up.sql` and `<version>_<name>.down.sql`, where version is a positive integer. Applied versions are recorded in the schema_migrations table. Each migration runs in its own transaction, unless its first line is `-- migrate:no-transaction`.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	noTransactionDirective = "-- migrate:no-transaction"
+	// lockKey is the key of the Postgres advisory lock held while migrating, so that concurrent instances do not race.
+	lockKey = 8_347_052_961
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrUnknownVersion   = errors.New("applied migration version is unknown")
+)
+
+var fileNameRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Dialect uint8
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+type Migration struct {
+	Name    string
+	Up      string
+	Down    string
+	Version int64
+}
+
+type Status struct {
+	AppliedAt time.Time
+	Name      string
+	Version   int64
+	Applied   bool
+}
+
+type migratorOpts struct {
+	dryRun  io.Writer
+	log     io.Writer
+	dialect Dialect
+}
+
+// WithDialect sets the SQL dialect of the database. The default is Postgres.
+func WithDialect(dialect Dialect) func(*migratorOpts) {
+	return func(mo *migratorOpts) {
+		mo.dialect = dialect
+	}
+}
+
+// WithDryRun makes the migrator write the SQL it would run to `w` instead of running it. A nil `w` disables dry run.
+func WithDryRun(w io.Writer) func(*migratorOpts) {
+	return func(mo *migratorOpts) {
+		mo.dryRun = w
+	}
+}
+
+// WithLog makes the migrator write a line to `w` for every migration it runs.
+func WithLog(w io.Writer) func(*migratorOpts) {
+	return func(mo *migratorOpts) {
+		mo.log = w
+	}
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dryRun     io.Writer
+	log        io.Writer
+	migrations []Migration
+	dialect    Dialect
+}
+
+// New reads and validates the migrations in the root of `fsys`.
+func New(db *sql.DB, fsys fs.FS, optFuncs ...func(*migratorOpts)) (*Migrator, error) {
+	opts := migratorOpts{log: io.Discard}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		dryRun:     opts.dryRun,
+		log:        opts.log,
+		migrations: migrations,
+		dialect:    opts.dialect,
+	}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		matches := fileNameRegex.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("%w: bad file name %s", ErrInvalidMigration, entry.Name())
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: bad version in %s", ErrInvalidMigration, entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("%w: version %d is used by both %s and %s", ErrInvalidMigration, version, m.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: version %d has no up migration", ErrInvalidMigration, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Migrations returns the known migrations in ascending order of version.
+func (m *Migrator) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// Up applies at most `steps` pending migrations in ascending order of version. Pass 0 to apply all.
+func (m *Migrator) Up(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if steps > 0 && n == steps {
+				break
+			}
+			if err = m.run(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+}
+
+// Down reverts the last `steps` applied migrations in descending order of version. Pass 0 to revert all.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, migration := range slices.Backward(m.migrations) {
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if steps > 0 && n == steps {
+				break
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%w: version %d has no down migration", ErrInvalidMigration, migration.Version)
+			}
+			if err = m.run(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+}
+
+// Status returns the status of every known migration in ascending order of version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = createMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Version: migration.Version, Name: migration.Name, Applied: ok, AppliedAt: appliedAt})
+		delete(applied, migration.Version)
+	}
+	for version := range applied {
+		return statuses, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return statuses, nil
+}
+
+// withLock runs `fn` on a single connection. On postgres, the connection holds the migration advisory lock. SQLite allows a single writer at a time, so no lock is taken.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect == SQLite {
+		if err = createMigrationsTable(ctx, conn); err != nil {
+			return err
+		}
+		return fn(conn)
+	}
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", lockKey); err != nil {
+		return fmt.Errorf("could not acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the session anyway, so use a fresh context in case `ctx` is done.
+		if _, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", lockKey); unlockErr != nil && err == nil {
+			err = fmt.Errorf("could not release migration lock: %w", unlockErr)
+		}
+	}()
+
+	if err = createMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	direction, query := "up", migration.Up
+	recordQuery, recordArgs := "INSERT INTO schema_migrations(version, name) VALUES($1, $2);", []any{migration.Version, migration.Name}
+	if !up {
+		direction, query = "down", migration.Down
+		recordQuery, recordArgs = "DELETE FROM schema_migrations WHERE version=$1;", []any{migration.Version}
+	}
+
+	if m.dryRun != nil {
+		_, err := fmt.Fprintf(m.dryRun, "-- %d_%s (%s)\n%s\n", migration.Version, migration.Name, direction, strings.TrimSpace(query))
+		return err
+	}
+
+	fmt.Fprintf(m.log, "migrating %s %d_%s\n", direction, migration.Version, migration.Name)
+
+	if strings.HasPrefix(strings.TrimSpace(query), noTransactionDirective) {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("could not run migration %d_%s (%s): %w", migration.Version, migration.Name, direction, err)
+		}
+		_, err := conn.ExecContext(ctx, recordQuery, recordArgs...)
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("could not run migration %d_%s (%s): %w", migration.Version, migration.Name, direction, err)
+	}
+	if _, err = tx.ExecContext(ctx, recordQuery, recordArgs...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations(version BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);")
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
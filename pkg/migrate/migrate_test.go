@@ -0,0 +1,109 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Load migrations in order", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0002_second.up.sql":   {Data: []byte("SELECT 2;")},
+			"0002_second.down.sql": {Data: []byte("SELECT -2;")},
+			"0001_first.up.sql":    {Data: []byte("SELECT 1;")},
+			"README.md":            {Data: []byte("ignored")},
+		}
+		m, err := migrate.New(nil, fsys)
+		assert.Nil(t, err)
+
+		migrations := m.Migrations()
+		assert.Len(t, migrations, 2)
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, "first", migrations[0].Name)
+		assert.Equal(t, "", migrations[0].Down)
+		assert.Equal(t, "SELECT -2;", migrations[1].Down)
+	})
+
+	t.Run("Reject invalid migrations", func(t *testing.T) {
+		for name, fsys := range map[string]fstest.MapFS{
+			"bad file name":   {"first.up.sql": {Data: []byte("SELECT 1;")}},
+			"missing up":      {"0001_first.down.sql": {Data: []byte("SELECT 1;")}},
+			"version clashes": {"0001_first.up.sql": {Data: []byte("SELECT 1;")}, "0001_other.up.sql": {Data: []byte("SELECT 1;")}},
+		} {
+			_, err := migrate.New(nil, fsys)
+			assert.ErrorIs(t, err, migrate.ErrInvalidMigration, name)
+		}
+	})
+
+	t.Run("Load repo migrations", func(t *testing.T) {
+		m, err := migrate.New(nil, repo.Migrations)
+		assert.Nil(t, err)
+		for _, migration := range m.Migrations() {
+			assert.NotEmpty(t, migration.Down, migration.Name)
+		}
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	fsys := fstest.MapFS{
+		"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a(id INTEGER);")},
+		"0001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b(id INTEGER);")},
+		"0002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	}
+
+	m, err := migrate.New(db, fsys, migrate.WithDialect(migrate.SQLite))
+	assert.Nil(t, err)
+
+	appliedCount := func() int {
+		statuses, err := m.Status(ctx)
+		assert.Nil(t, err)
+		n := 0
+		for _, s := range statuses {
+			if s.Applied {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("Dry run", func(t *testing.T) {
+		var out bytes.Buffer
+		dryRun, err := migrate.New(db, fsys, migrate.WithDialect(migrate.SQLite), migrate.WithDryRun(&out))
+		assert.Nil(t, err)
+		assert.Nil(t, dryRun.Up(ctx, 0))
+		assert.Contains(t, out.String(), "CREATE TABLE b")
+		assert.Equal(t, 0, appliedCount())
+	})
+
+	t.Run("Up", func(t *testing.T) {
+		assert.Nil(t, m.Up(ctx, 1))
+		assert.Equal(t, 1, appliedCount())
+		assert.Nil(t, m.Up(ctx, 0))
+		assert.Equal(t, 2, appliedCount())
+		_, err := db.Exec("INSERT INTO b(id) VALUES(1);")
+		assert.Nil(t, err)
+	})
+
+	t.Run("Down", func(t *testing.T) {
+		assert.Nil(t, m.Down(ctx, 1))
+		assert.Equal(t, 1, appliedCount())
+		_, err := db.Exec("INSERT INTO b(id) VALUES(1);")
+		assert.NotNil(t, err)
+	})
+}
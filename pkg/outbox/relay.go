@@ -0,0 +1,139 @@
+// Package outbox relays the domain events of the transactional outbox to sinks.
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const maxRetryBackoff = time.Hour
+
+// Store is the outbox table. It is implemented by *repo.Repo.
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]repo.OutboxEvent, error)
+	MarkOutboxEventDelivered(ctx context.Context, eventId string) error
+	RetryOutboxEvent(ctx context.Context, eventId string, lastError string, retryAt time.Time) error
+	DeadLetterOutboxEvent(ctx context.Context, eventId string, lastError string) error
+}
+
+// Sink delivers events to another system. Events are delivered at least once, so sinks and their consumers should deduplicate them by id.
+type Sink interface {
+	Deliver(ctx context.Context, event *repo.OutboxEvent) error
+}
+
+type relayOpts struct {
+	batchSize    int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+// WithBatchSize sets how many events are claimed at a time. The default is 100.
+func WithBatchSize(n int) func(*relayOpts) {
+	return func(ro *relayOpts) {
+		ro.batchSize = n
+	}
+}
+
+// WithPollInterval sets how long the relay waits before polling again when there are no pending events. The default is 1s.
+func WithPollInterval(d time.Duration) func(*relayOpts) {
+	return func(ro *relayOpts) {
+		ro.pollInterval = d
+	}
+}
+
+// WithLease sets how long claimed events are hidden from other relays. It must be longer than it takes to deliver a batch. The default is 1m.
+func WithLease(d time.Duration) func(*relayOpts) {
+	return func(ro *relayOpts) {
+		ro.lease = d
+	}
+}
+
+// WithMaxAttempts sets how many times delivering an event is attempted before it is dead-lettered. The default is 10.
+func WithMaxAttempts(n int) func(*relayOpts) {
+	return func(ro *relayOpts) {
+		ro.maxAttempts = n
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry, which doubles with each attempt up to an hour. The default is 10s.
+func WithRetryBackoff(d time.Duration) func(*relayOpts) {
+	return func(ro *relayOpts) {
+		ro.retryBackoff = d
+	}
+}
+
+// Relay delivers the events of the outbox to a sink. Several relays can run at the same time, as each event is claimed by one of them.
+type Relay struct {
+	store Store
+	sink  Sink
+	opts  relayOpts
+}
+
+func NewRelay(store Store, sink Sink, optFuncs ...func(*relayOpts)) *Relay {
+	opts := relayOpts{
+		batchSize:    100,
+		pollInterval: time.Second,
+		lease:        time.Minute,
+		maxAttempts:  10,
+		retryBackoff: time.Second * 10,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return &Relay{store: store, sink: sink, opts: opts}
+}
+
+// Run relays events until `ctx` is canceled.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		n, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "relay outbox events", slog.Any("error", err))
+		}
+		// Poll again right away while there may be more pending events.
+		if err == nil && n == r.opts.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.opts.pollInterval):
+		}
+	}
+}
+
+// RelayBatch claims a batch of pending events and delivers them, and returns how many were claimed. Events that fail to be delivered are retried with backoff, and dead-lettered once they run out of attempts.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	events, err := r.store.ClaimOutboxEvents(ctx, r.opts.batchSize, r.opts.lease)
+	if err != nil {
+		return 0, err
+	}
+	for i := range events {
+		event := &events[i]
+		if err = r.sink.Deliver(ctx, event); err == nil {
+			err = r.store.MarkOutboxEventDelivered(ctx, event.Id)
+		} else if event.Attempts >= r.opts.maxAttempts {
+			slog.ErrorContext(ctx, "dead-letter outbox event", slog.String("id", event.Id), slog.String("topic", event.Topic), slog.Int("attempts", event.Attempts), slog.Any("error", err))
+			err = r.store.DeadLetterOutboxEvent(ctx, event.Id, err.Error())
+		} else {
+			slog.WarnContext(ctx, "deliver outbox event", slog.String("id", event.Id), slog.String("topic", event.Topic), slog.Int("attempts", event.Attempts), slog.Any("error", err))
+			err = r.store.RetryOutboxEvent(ctx, event.Id, err.Error(), time.Now().Add(r.backoff(event.Attempts)))
+		}
+		// The event is claimed again once its lease expires.
+		if err != nil {
+			return len(events), err
+		}
+	}
+	return len(events), nil
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	backoff := float64(r.opts.retryBackoff) * math.Pow(2, float64(attempts-1))
+	return time.Duration(min(backoff, float64(maxRetryBackoff)))
+}
@@ -0,0 +1,146 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/outbox"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an in-memory outbox table.
+type memoryStore struct {
+	mu        sync.Mutex
+	events    []repo.OutboxEvent
+	delivered map[string]bool
+	dead      map[string]string
+	retryAt   map[string]time.Time
+}
+
+func newMemoryStore(events ...repo.OutboxEvent) *memoryStore {
+	return &memoryStore{events: events, delivered: map[string]bool{}, dead: map[string]string{}, retryAt: map[string]time.Time{}}
+}
+
+func (s *memoryStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]repo.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []repo.OutboxEvent
+	for i := range s.events {
+		event := &s.events[i]
+		if s.delivered[event.Id] || s.dead[event.Id] != "" || time.Now().Before(s.retryAt[event.Id]) || len(claimed) == limit {
+			continue
+		}
+		event.Attempts++
+		claimed = append(claimed, *event)
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) MarkOutboxEventDelivered(ctx context.Context, eventId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered[eventId] = true
+	return nil
+}
+
+func (s *memoryStore) RetryOutboxEvent(ctx context.Context, eventId string, lastError string, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryAt[eventId] = retryAt
+	return nil
+}
+
+func (s *memoryStore) DeadLetterOutboxEvent(ctx context.Context, eventId string, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead[eventId] = lastError
+	return nil
+}
+
+// failingSink fails to deliver the events with the given ids.
+type failingSink struct {
+	fail      map[string]bool
+	delivered []string
+}
+
+func (s *failingSink) Deliver(ctx context.Context, event *repo.OutboxEvent) error {
+	if s.fail[event.Id] {
+		return errors.New("sink is down")
+	}
+	s.delivered = append(s.delivered, event.Id)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Deliver events", func(t *testing.T) {
+		store := newMemoryStore(repo.OutboxEvent{Id: "1"}, repo.OutboxEvent{Id: "2"}, repo.OutboxEvent{Id: "3"})
+		sink := &failingSink{}
+		relay := outbox.NewRelay(store, sink, outbox.WithBatchSize(2))
+
+		n, err := relay.RelayBatch(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+		n, err = relay.RelayBatch(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, n)
+		n, err = relay.RelayBatch(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, []string{"1", "2", "3"}, sink.delivered)
+	})
+
+	t.Run("Retry with backoff", func(t *testing.T) {
+		store := newMemoryStore(repo.OutboxEvent{Id: "1"})
+		relay := outbox.NewRelay(store, &failingSink{fail: map[string]bool{"1": true}}, outbox.WithRetryBackoff(time.Minute))
+
+		_, err := relay.RelayBatch(ctx)
+		assert.Nil(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), store.retryAt["1"], time.Second)
+		assert.False(t, store.delivered["1"])
+
+		// The event is not claimed again until it is retried.
+		n, err := relay.RelayBatch(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("Dead-letter after max attempts", func(t *testing.T) {
+		store := newMemoryStore(repo.OutboxEvent{Id: "1"})
+		relay := outbox.NewRelay(store, &failingSink{fail: map[string]bool{"1": true}}, outbox.WithMaxAttempts(3), outbox.WithRetryBackoff(time.Nanosecond))
+
+		for range 3 {
+			_, err := relay.RelayBatch(ctx)
+			assert.Nil(t, err)
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, "sink is down", store.dead["1"])
+
+		n, err := relay.RelayBatch(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("Run until canceled", func(t *testing.T) {
+		store := newMemoryStore(repo.OutboxEvent{Id: "1"})
+		sink := &failingSink{}
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			outbox.NewRelay(store, sink, outbox.WithPollInterval(time.Millisecond)).Run(ctx)
+		}()
+		assert.Eventually(t, func() bool {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			return store.delivered["1"]
+		}, time.Second, time.Millisecond)
+		cancel()
+		<-done
+	})
+}
@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+// LogSink logs events, which is useful in development.
+type LogSink struct{}
+
+func (LogSink) Deliver(ctx context.Context, event *repo.OutboxEvent) error {
+	slog.InfoContext(ctx, "Outbox event", slog.String("id", event.Id), slog.String("topic", event.Topic), slog.String("payload", string(event.Payload)))
+	return nil
+}
+
+// WebhookSink posts events as JSON to a URL. Responses other than 2xx are failed deliveries.
+type WebhookSink struct {
+	client *http.Client
+	url    string
+	secret []byte
+}
+
+// NewWebhookSink creates a sink that posts events to `url`. If `secret` is not empty, the body is signed with HMAC-SHA256 in the X-Signature header as "sha256=<hex>".
+func NewWebhookSink(url string, secret string) *WebhookSink {
+	return &WebhookSink{
+		client: &http.Client{Timeout: time.Second * 10},
+		url:    url,
+		secret: []byte(secret),
+	}
+}
+
+func (s *WebhookSink) Deliver(ctx context.Context, event *repo.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", event.Id)
+	req.Header.Set("X-Event-Topic", event.Topic)
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// FileSink appends events to a file as JSON lines.
+type FileSink struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileSink opens the file at `path` for appending, creating it if it does not exist.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open outbox file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Deliver(ctx context.Context, event *repo.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// The event is marked as delivered after this returns, so it must be on disk.
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,70 @@
+package outbox_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rohitxdev/go-api-starter/pkg/outbox"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSink(t *testing.T) {
+	event := &repo.OutboxEvent{Id: "obx_1", Topic: repo.EventUserCreated, Payload: json.RawMessage(`{"user_id":"usr_1"}`)}
+
+	t.Run("Signed delivery", func(t *testing.T) {
+		var body []byte
+		var signature string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			signature = r.Header.Get("X-Signature")
+			assert.Equal(t, "obx_1", r.Header.Get("X-Event-Id"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		assert.Nil(t, outbox.NewWebhookSink(server.URL, "secret").Deliver(context.Background(), event))
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), signature)
+		assert.Contains(t, string(body), `"topic":"user.created"`)
+	})
+
+	t.Run("Failed delivery", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		assert.NotNil(t, outbox.NewWebhookSink(server.URL, "").Deliver(context.Background(), event))
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	sink, err := outbox.NewFileSink(path)
+	assert.Nil(t, err)
+
+	for _, id := range []string{"obx_1", "obx_2"} {
+		assert.Nil(t, sink.Deliver(context.Background(), &repo.OutboxEvent{Id: id, Topic: repo.EventUserCreated, Payload: json.RawMessage(`{}`)}))
+	}
+	assert.Nil(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	var event repo.OutboxEvent
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, "obx_2", event.Id)
+}
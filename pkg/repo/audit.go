@@ -0,0 +1,168 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+)
+
+// Audit event actions.
+const (
+	AuditSignUp            = "auth.sign_up"
+	AuditLogIn             = "auth.log_in"
+	AuditLogInFailed       = "auth.log_in_failed"
+	AuditLogOut            = "auth.log_out"
+	AuditPasswordChanged   = "auth.password_changed"
+	AuditPasswordReset     = "auth.password_reset"
+	AuditNewDeviceLogIn    = "auth.new_device_log_in"
+	AuditSessionsRevoked   = "auth.sessions_revoked"
+	AuditReauthenticated   = "auth.reauthenticated"
+	AuditReauthFailed      = "auth.reauthentication_failed"
+	AuditAccountDeleted    = "auth.account_deleted"
+	AuditRoleChanged       = "admin.role_changed"
+	AuditAccountRestored   = "admin.account_restored"
+	AuditInviteCreated     = "admin.invite_created"
+	AuditInviteRevoked     = "admin.invite_revoked"
+	AuditOrgCreated        = "org.created"
+	AuditOrgMemberUpdated  = "org.member_updated"
+	AuditOrgMemberRemoved  = "org.member_removed"
+	AuditOrgInviteCreated  = "org.invitation_created"
+	AuditOrgInviteRevoked  = "org.invitation_revoked"
+	AuditOrgInviteAccepted = "org.invitation_accepted"
+)
+
+const (
+	defaultAuditEventsLimit = 50
+	maxAuditEventsLimit     = 200
+)
+
+/*----------------------------------- Audit Event Type ----------------------------------- */
+
+type AuditEvent struct {
+	CreatedAt time.Time      `json:"created_at"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Id        string         `json:"id"`
+	ActorId   string         `json:"actor_id,omitempty"`
+	TargetId  string         `json:"target_id,omitempty"`
+	Action    string         `json:"action"`
+	Ip        string         `json:"ip,omitempty"`
+	UserAgent string         `json:"user_agent,omitempty"`
+	RequestId string         `json:"request_id,omitempty"`
+}
+
+func (repo *Repo) CreateAuditEvent(ctx context.Context, event *AuditEvent) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateAuditEvent")
+	eventId := id.New(id.AuditEvent)
+	var metadata []byte
+	if len(event.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(event.Metadata); err != nil {
+			return "", translateError(err)
+		}
+	}
+	_, err := repo.db.ExecContext(ctx, `INSERT INTO audit_events(id, actor_id, target_id, action, ip, user_agent, request_id, metadata) VALUES($1, NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8);`, eventId, event.ActorId, event.TargetId, event.Action, event.Ip, event.UserAgent, event.RequestId, metadata)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return eventId, nil
+}
+
+type AuditEventFilter struct {
+	Since time.Time
+	Until time.Time
+	// UserId matches events where the user is either the actor or the target.
+	UserId   string
+	ActorId  string
+	TargetId string
+	Action   string
+	Cursor   string
+	Limit    int
+}
+
+// GetAuditEvents returns audit events matching the filter, newest first, and the cursor of the next page. The cursor is empty on the last page.
+func (repo *Repo) GetAuditEvents(ctx context.Context, filter *AuditEventFilter) ([]AuditEvent, string, error) {
+	ctx = database.WithQueryName(ctx, "GetAuditEvents")
+	var conditions []string
+	var params []any
+
+	addCondition := func(format string, value any) {
+		params = append(params, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(params)))
+	}
+
+	if filter.UserId != "" {
+		params = append(params, filter.UserId)
+		conditions = append(conditions, fmt.Sprintf("(actor_id=$%[1]d OR target_id=$%[1]d)", len(params)))
+	}
+	if filter.ActorId != "" {
+		addCondition("actor_id=$%d", filter.ActorId)
+	}
+	if filter.TargetId != "" {
+		addCondition("target_id=$%d", filter.TargetId)
+	}
+	if filter.Action != "" {
+		addCondition("action=$%d", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		addCondition("created_at>=$%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		addCondition("created_at<$%d", filter.Until)
+	}
+	if filter.Cursor != "" {
+		lastId, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", translateError(err)
+		}
+		addCondition("id<$%d", lastId)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditEventsLimit
+	}
+	limit = min(limit, maxAuditEventsLimit)
+
+	query := "SELECT id, COALESCE(actor_id, ''), COALESCE(target_id, ''), action, COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(request_id, ''), metadata, created_at FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page.
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d;", limit+1)
+
+	rows, err := repo.reader(ctx).QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, "", translateError(err)
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var event AuditEvent
+		var metadata []byte
+		if err = rows.Scan(&event.Id, &event.ActorId, &event.TargetId, &event.Action, &event.Ip, &event.UserAgent, &event.RequestId, &metadata, &event.CreatedAt); err != nil {
+			return nil, "", translateError(err)
+		}
+		if metadata != nil {
+			if err = json.Unmarshal(metadata, &event.Metadata); err != nil {
+				return nil, "", translateError(err)
+			}
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", translateError(err)
+	}
+
+	var nextCursor string
+	if len(events) > limit {
+		events = events[:limit]
+		nextCursor = encodeCursor(events[limit-1].Id)
+	}
+	return events, nextCursor, nil
+}
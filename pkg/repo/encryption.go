@@ -0,0 +1,252 @@
+package repo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rohitxdev/go-api-starter/pkg/cryptoutil"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+)
+
+// encryptedPrefix marks encrypted column values, which are stored as `enc:<key id>:<base64 ciphertext>`. Values without it are plaintext written before encryption was enabled.
+const encryptedPrefix = "enc:"
+
+var (
+	ErrUnknownKeyId   = errors.New("unknown encryption key id")
+	ErrInvalidKeyring = errors.New("invalid keyring")
+)
+
+// encryptedColumns are the users columns encrypted by the keyring.
+var encryptedColumns = []string{"phone_number", "date_of_birth"}
+
+// blindIndexColumns maps encrypted users columns to the columns holding their blind index, for exact-match lookups.
+var blindIndexColumns = map[string]string{
+	"phone_number": "phone_number_hash",
+}
+
+// Keyring holds the keys used to encrypt PII columns of the users table.
+type Keyring struct {
+	keys     map[string][]byte
+	keyId    string
+	indexKey []byte
+}
+
+// NewKeyring returns a keyring that encrypts new values with the key `keyId` of `keys`, and decrypts values encrypted with any key of `keys`. Keys must be 16, 24 or 32 bytes long. `indexKey` is the HMAC key of the blind indexes. It cannot be rotated, as existing indexes would stop matching.
+func NewKeyring(keys map[string][]byte, keyId string, indexKey []byte) (*Keyring, error) {
+	if _, ok := keys[keyId]; !ok {
+		return nil, fmt.Errorf("%w: key %q not found", ErrInvalidKeyring, keyId)
+	}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%w: key id %q must be non-empty and not contain ':'", ErrInvalidKeyring, id)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("%w: key %q must be 16, 24 or 32 bytes long", ErrInvalidKeyring, id)
+		}
+	}
+	if len(indexKey) < 32 {
+		return nil, fmt.Errorf("%w: index key must be at least 32 bytes long", ErrInvalidKeyring)
+	}
+	return &Keyring{keys: keys, keyId: keyId, indexKey: indexKey}, nil
+}
+
+func (k *Keyring) encrypt(value string) (string, error) {
+	data, err := cryptoutil.EncryptAES([]byte(value), k.keys[k.keyId])
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + k.keyId + ":" + base64.RawStdEncoding.EncodeToString(data), nil
+}
+
+// decrypt returns the plaintext of an encrypted value. Plaintext values are returned as is, even if k is nil.
+func (k *Keyring) decrypt(value string) (string, error) {
+	keyId, data, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !strings.HasPrefix(value, encryptedPrefix) || !ok {
+		return value, nil
+	}
+	var key []byte
+	if k != nil {
+		key = k.keys[keyId]
+	}
+	if key == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKeyId, keyId)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := cryptoutil.DecryptAES(ciphertext, key)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// isCurrent reports whether `value` is encrypted with the newest key.
+func (k *Keyring) isCurrent(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix+k.keyId+":")
+}
+
+// blindIndex returns the HMAC of `value`, which can be stored and queried in place of the value for exact-match lookups.
+func (k *Keyring) blindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encryptUpdates returns a copy of users column updates with the encrypted columns encrypted and their blind indexes set. Without a keyring, updates are returned as is.
+func (k *Keyring) encryptUpdates(updates map[string]any) (map[string]any, error) {
+	if k == nil {
+		return updates, nil
+	}
+	encrypted := make(map[string]any, len(updates))
+	for column, value := range updates {
+		encrypted[column] = value
+	}
+	for _, column := range encryptedColumns {
+		value, ok := updates[column]
+		if !ok {
+			continue
+		}
+		indexColumn := blindIndexColumns[column]
+		s, ok := value.(string)
+		if !ok || s == "" {
+			if indexColumn != "" {
+				encrypted[indexColumn] = nil
+			}
+			continue
+		}
+		ciphertext, err := k.encrypt(s)
+		if err != nil {
+			return nil, err
+		}
+		encrypted[column] = ciphertext
+		if indexColumn != "" {
+			encrypted[indexColumn] = k.blindIndex(s)
+		}
+	}
+	return encrypted, nil
+}
+
+// decryptUser decrypts the encrypted fields of `user` in place.
+func (k *Keyring) decryptUser(user *User) error {
+	var err error
+	if user.PhoneNumber, err = k.decrypt(user.PhoneNumber); err != nil {
+		return err
+	}
+	if user.DateOfBirth, err = k.decrypt(user.DateOfBirth); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUserByPhoneNumber returns the user with the phone number, looking it up by its blind index if the repo has a keyring.
+func (repo *Repo) GetUserByPhoneNumber(ctx context.Context, phoneNumber string, optFuncs ...func(*queryOpts)) (*User, error) {
+	ctx = database.WithQueryName(ctx, "GetUserByPhoneNumber")
+	opts := newQueryOpts(optFuncs)
+	where := "phone_number=$1"
+	if repo.keyring != nil {
+		where = "phone_number_hash=$1"
+		phoneNumber = repo.keyring.blindIndex(phoneNumber)
+	}
+	user := new(User)
+	err := repo.reader(ctx).QueryRowContext(ctx, `SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at, version, deleted_at FROM users WHERE `+where+` AND ($2::boolean OR deleted_at IS NULL) LIMIT 1;`, phoneNumber, opts.includeDeleted).Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.DeletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, translateError(err)
+	}
+	if err = repo.keyring.decryptUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ReencryptUsers re-encrypts the encrypted columns of users that are in plaintext or encrypted with an older key using the newest key, `batchSize` rows at a time. It returns the number of users re-encrypted. Rows updated concurrently are skipped and picked up by the next run.
+func (repo *Repo) ReencryptUsers(ctx context.Context, batchSize int) (int, error) {
+	ctx = database.WithQueryName(ctx, "ReencryptUsers")
+	if repo.keyring == nil {
+		return 0, fmt.Errorf("%w: repo has no keyring", ErrInvalidKeyring)
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	type row struct {
+		id          string
+		phoneNumber *string
+		dateOfBirth *string
+	}
+
+	var count int
+	lastId := ""
+	for {
+		rows, err := repo.db.QueryContext(ctx, `SELECT id, phone_number, date_of_birth FROM users WHERE id>$1 ORDER BY id LIMIT $2;`, lastId, batchSize)
+		if err != nil {
+			return count, translateError(err)
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err = rows.Scan(&r.id, &r.phoneNumber, &r.dateOfBirth); err != nil {
+				rows.Close()
+				return count, translateError(err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return count, translateError(err)
+		}
+		if len(batch) == 0 {
+			return count, nil
+		}
+		lastId = batch[len(batch)-1].id
+
+		for _, r := range batch {
+			updates := map[string]any{}
+			for column, value := range map[string]*string{"phone_number": r.phoneNumber, "date_of_birth": r.dateOfBirth} {
+				if value == nil || repo.keyring.isCurrent(*value) {
+					continue
+				}
+				plaintext, err := repo.keyring.decrypt(*value)
+				if err != nil {
+					return count, fmt.Errorf("decrypt %s of user %s: %w", column, r.id, err)
+				}
+				updates[column] = plaintext
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if updates, err = repo.keyring.encryptUpdates(updates); err != nil {
+				return count, err
+			}
+
+			// Only the representation of the values changes, so the version and updated_at are left as is.
+			query := "UPDATE users SET "
+			var params []any
+			for column, value := range updates {
+				params = append(params, value)
+				query += fmt.Sprintf("%s=$%d, ", column, len(params))
+			}
+			params = append(params, r.id, r.phoneNumber, r.dateOfBirth)
+			query = query[:len(query)-2] + fmt.Sprintf(" WHERE id=$%d AND phone_number IS NOT DISTINCT FROM $%d AND date_of_birth IS NOT DISTINCT FROM $%d;", len(params)-2, len(params)-1, len(params))
+
+			res, err := repo.db.ExecContext(ctx, query, params...)
+			if err != nil {
+				return count, translateError(err)
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				count++
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package repo_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeyring(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	indexKey := bytes.Repeat([]byte{2}, 32)
+
+	tests := []struct {
+		name     string
+		keys     map[string][]byte
+		keyId    string
+		indexKey []byte
+		wantErr  bool
+	}{
+		{name: "Valid keyring", keys: map[string][]byte{"k1": key, "k2": key[:16]}, keyId: "k2", indexKey: indexKey},
+		{name: "Unknown key id", keys: map[string][]byte{"k1": key}, keyId: "k2", indexKey: indexKey, wantErr: true},
+		{name: "Key id with colon", keys: map[string][]byte{"k:1": key}, keyId: "k:1", indexKey: indexKey, wantErr: true},
+		{name: "Invalid key length", keys: map[string][]byte{"k1": key[:20]}, keyId: "k1", indexKey: indexKey, wantErr: true},
+		{name: "Short index key", keys: map[string][]byte{"k1": key}, keyId: "k1", indexKey: indexKey[:16], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repo.NewKeyring(tt.keys, tt.keyId, tt.indexKey)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, repo.ErrInvalidKeyring)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
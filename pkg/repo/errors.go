@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Kinds of database errors. Use errors.Is to check the kind of an error returned by the repo, and errors.As with *Error to get the constraint and column.
+var (
+	ErrUniqueViolation      = errors.New("unique violation")
+	ErrForeignKeyViolation  = errors.New("foreign key violation")
+	ErrCheckViolation       = errors.New("check violation")
+	ErrNotNullViolation     = errors.New("not null violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrDeadlock             = errors.New("deadlock detected")
+	ErrTimeout              = errors.New("query timed out")
+)
+
+// Error is a database error translated into one of the kinds above.
+type Error struct {
+	// Kind is one of the error kinds above.
+	Kind       error
+	Err        error
+	Table      string
+	Column     string
+	Constraint string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Kind.Error())
+	if e.Table != "" {
+		b.WriteString(" on " + e.Table)
+		if e.Column != "" {
+			b.WriteString("." + e.Column)
+		}
+	} else if e.Column != "" {
+		b.WriteString(" on " + e.Column)
+	}
+	if e.Constraint != "" {
+		b.WriteString(" (" + e.Constraint + ")")
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+var (
+	// pqKeyDetailRegex matches the detail of postgres key violations, e.g. "Key (email)=(a@b.com) already exists.".
+	pqKeyDetailRegex = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+	// sqliteConstraintRegex matches the message of sqlite constraint violations, e.g. "UNIQUE constraint failed: users.email".
+	sqliteConstraintRegex = regexp.MustCompile(`constraint failed: (\w+)\.(\w+)`)
+	// sqliteCheckRegex matches the message of sqlite check violations, e.g. "CHECK constraint failed: role IN ('user', 'admin')".
+	sqliteCheckRegex = regexp.MustCompile(`CHECK constraint failed: (.+?)(?: \(\d+\))?$`)
+)
+
+// translateError translates postgres and sqlite driver errors into *Error. Other errors, including sql.ErrNoRows, are returned as is.
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e := (*Error)(nil); errors.As(err, &e) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		e := &Error{
+			Err:        err,
+			Table:      pqErr.Table,
+			Column:     pqErr.Column,
+			Constraint: pqErr.Constraint,
+		}
+		if e.Column == "" {
+			if matches := pqKeyDetailRegex.FindStringSubmatch(pqErr.Detail); matches != nil {
+				e.Column = matches[1]
+			}
+		}
+		switch pqErr.Code {
+		case "23505":
+			e.Kind = ErrUniqueViolation
+		case "23503":
+			e.Kind = ErrForeignKeyViolation
+		case "23514":
+			e.Kind = ErrCheckViolation
+		case "23502":
+			e.Kind = ErrNotNullViolation
+		case "40001":
+			e.Kind = ErrSerializationFailure
+		case "40P01":
+			e.Kind = ErrDeadlock
+		case "57014", "55P03": // query_canceled (statement timeout), lock_not_available (lock timeout)
+			e.Kind = ErrTimeout
+		default:
+			return err
+		}
+		return e
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		e := &Error{Err: err}
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			e.Kind = ErrUniqueViolation
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			e.Kind = ErrForeignKeyViolation
+		case sqlite3.SQLITE_CONSTRAINT_CHECK:
+			e.Kind = ErrCheckViolation
+			if matches := sqliteCheckRegex.FindStringSubmatch(sqliteErr.Error()); matches != nil {
+				e.Constraint = matches[1]
+			}
+		case sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+			e.Kind = ErrNotNullViolation
+		case sqlite3.SQLITE_BUSY:
+			e.Kind = ErrTimeout
+		default:
+			return err
+		}
+		if matches := sqliteConstraintRegex.FindStringSubmatch(sqliteErr.Error()); matches != nil {
+			e.Table, e.Column = matches[1], matches[2]
+		}
+		return e
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &Error{Kind: ErrTimeout, Err: err}
+	}
+
+	return err
+}
+
+// translateUserError translates err like translateError, additionally returning ErrUserAlreadyExists for duplicate emails.
+func translateUserError(err error) error {
+	err = translateError(err)
+	var e *Error
+	if errors.As(err, &e) && e.Kind == ErrUniqueViolation && e.Column == "email" {
+		return fmt.Errorf("%w: %w", ErrUserAlreadyExists, err)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+)
+
+var (
+	ErrInviteInvalid  = errors.New("invite is invalid or expired")
+	ErrInviteNotFound = errors.New("invite not found")
+)
+
+/*----------------------------------- Invite Type ----------------------------------- */
+
+type Invite struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Id        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by,omitempty"`
+}
+
+// CreateInvite stores an invite. Only the hash of the invite token is persisted, so the token itself must be delivered to the invitee by the caller.
+func (repo *Repo) CreateInvite(ctx context.Context, invite *Invite, tokenHash string) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateInvite")
+	inviteId := id.New(id.Invite)
+	err := repo.db.QueryRowContext(ctx, `INSERT INTO invites(id, email, role, token_hash, invited_by, expires_at) VALUES($1, $2, COALESCE(NULLIF($3, ''), 'user'), $4, NULLIF($5, ''), $6) RETURNING id;`, inviteId, invite.Email, invite.Role, tokenHash, invite.InvitedBy, invite.ExpiresAt).Scan(&inviteId)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return inviteId, nil
+}
+
+// ConsumeInvite marks the unexpired, unused invite matching the token hash and email as used and returns it. An invite can be consumed only once.
+func (repo *Repo) ConsumeInvite(ctx context.Context, tokenHash string, email string) (*Invite, error) {
+	ctx = database.WithQueryName(ctx, "ConsumeInvite")
+	invite := new(Invite)
+	err := repo.db.QueryRowContext(ctx, `UPDATE invites SET consumed_at=current_timestamp WHERE token_hash=$1 AND email=$2 AND consumed_at IS NULL AND expires_at>current_timestamp RETURNING id, email, role, COALESCE(invited_by, ''), expires_at;`, tokenHash, email).Scan(&invite.Id, &invite.Email, &invite.Role, &invite.InvitedBy, &invite.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInviteInvalid
+		}
+		return nil, translateError(err)
+	}
+	return invite, nil
+}
+
+func (repo *Repo) DeleteInviteById(ctx context.Context, inviteId string) error {
+	ctx = database.WithQueryName(ctx, "DeleteInviteById")
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM invites WHERE id=$1;`, inviteId)
+	if err != nil {
+		return translateError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredInvites deletes the invites and organization invitations that expired before being used, and returns how many there were.
+func (repo *Repo) DeleteExpiredInvites(ctx context.Context) (int64, error) {
+	ctx = database.WithQueryName(ctx, "DeleteExpiredInvites")
+	var total int64
+	for _, query := range [...]string{
+		`DELETE FROM invites WHERE consumed_at IS NULL AND expires_at<current_timestamp;`,
+		`DELETE FROM org_invitations WHERE accepted_at IS NULL AND expires_at<current_timestamp;`,
+	} {
+		res, err := repo.db.ExecContext(ctx, query)
+		if err != nil {
+			return total, translateError(err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, translateError(err)
+		}
+		total += n
+	}
+	return total, nil
+}
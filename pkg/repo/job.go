@@ -0,0 +1,240 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+)
+
+// Job statuses.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	defaultJobsLimit = 50
+	maxJobsLimit     = 200
+)
+
+// FinishedJobRetention is how long succeeded and failed jobs are kept, after which DeleteFinishedJobs deletes them.
+const FinishedJobRetention = time.Hour * 24 * 7
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobAlreadyQueued = errors.New("job with the same unique key is already queued")
+)
+
+/*----------------------------------- Job Type ----------------------------------- */
+
+type Job struct {
+	RunAt      time.Time  `json:"run_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Payload is not serialized, as it may hold secrets such as tokens.
+	Payload   json.RawMessage `json:"-"`
+	Id        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Status    string          `json:"status"`
+	UniqueKey string          `json:"unique_key,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	// Attempts is the number of times the job has been run, including the current run.
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// jobs.id is qualified, as the claim query joins on id.
+const jobColumns = "jobs.id, kind, payload, status, COALESCE(unique_key, ''), attempts, max_attempts, COALESCE(last_error, ''), run_at, created_at, finished_at"
+
+func scanJob(row interface{ Scan(...any) error }, job *Job) error {
+	return row.Scan(&job.Id, &job.Kind, &job.Payload, &job.Status, &job.UniqueKey, &job.Attempts, &job.MaxAttempts, &job.LastError, &job.RunAt, &job.CreatedAt, &job.FinishedAt)
+}
+
+// EnqueueJob adds the job to the queue, using its Kind, Payload, and optionally UniqueKey, RunAt and MaxAttempts. Call it inside WithTx to only run the job if the transaction commits. It fails with ErrJobAlreadyQueued if a pending or running job of the same kind has the same unique key.
+func (repo *Repo) EnqueueJob(ctx context.Context, job *Job) (string, error) {
+	ctx = database.WithQueryName(ctx, "EnqueueJob")
+	jobId := id.New(id.Job)
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+	// ON CONFLICT DO NOTHING, unlike a unique violation, does not abort the transaction the job is enqueued in.
+	err := repo.db.QueryRowContext(ctx, `INSERT INTO jobs(id, kind, payload, unique_key, run_at, max_attempts) VALUES($1, $2, $3, NULLIF($4, ''), COALESCE($5, current_timestamp), COALESCE(NULLIF($6, 0), 5))
+ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL AND status IN ('pending', 'running') DO NOTHING RETURNING id;`, jobId, job.Kind, []byte(job.Payload), job.UniqueKey, runAt, job.MaxAttempts).Scan(&jobId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrJobAlreadyQueued
+	}
+	if err != nil {
+		return "", translateError(err)
+	}
+	return jobId, nil
+}
+
+// ClaimJobs claims up to `limit` jobs of the given kinds that are due, marks them as running and counts the attempt. Running jobs whose `lease` has expired, for example because their worker crashed, are claimed again. Rows locked by other workers are skipped.
+func (repo *Repo) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]Job, error) {
+	ctx = database.WithQueryName(ctx, "ClaimJobs")
+	rows, err := repo.db.QueryContext(ctx, `WITH claimed AS (SELECT id FROM jobs WHERE kind=ANY($1) AND ((status='pending' AND run_at<=current_timestamp) OR (status='running' AND locked_until<current_timestamp)) ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED)
+UPDATE jobs SET status='running', attempts=attempts+1, locked_until=current_timestamp+$3*interval '1 second' FROM claimed WHERE jobs.id=claimed.id RETURNING `+jobColumns+`;`, pq.Array(kinds), limit, lease.Seconds())
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		if err = scanJob(rows, &job); err != nil {
+			return nil, translateError(err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return jobs, nil
+}
+
+// CompleteJob records a successful run of the job. Its payload is cleared, as it may hold secrets such as tokens and the job is not run again.
+func (repo *Repo) CompleteJob(ctx context.Context, jobId string) error {
+	ctx = database.WithQueryName(ctx, "CompleteJob")
+	_, err := repo.db.ExecContext(ctx, `UPDATE jobs SET status='succeeded', payload='null', last_error=NULL, locked_until=NULL, finished_at=current_timestamp WHERE id=$1;`, jobId)
+	return translateError(err)
+}
+
+// RetryJob records a failed run of the job and runs it again at `runAt`.
+func (repo *Repo) RetryJob(ctx context.Context, jobId string, lastError string, runAt time.Time) error {
+	ctx = database.WithQueryName(ctx, "RetryJob")
+	_, err := repo.db.ExecContext(ctx, `UPDATE jobs SET status='pending', last_error=$2, run_at=$3, locked_until=NULL WHERE id=$1;`, jobId, lastError, runAt)
+	return translateError(err)
+}
+
+// FailJob records a failed run of the job and stops running it. Failed jobs can be run again using RequeueJob.
+func (repo *Repo) FailJob(ctx context.Context, jobId string, lastError string) error {
+	ctx = database.WithQueryName(ctx, "FailJob")
+	_, err := repo.db.ExecContext(ctx, `UPDATE jobs SET status='failed', last_error=$2, locked_until=NULL, finished_at=current_timestamp WHERE id=$1;`, jobId, lastError)
+	return translateError(err)
+}
+
+// DeleteFinishedJobs deletes the succeeded and failed jobs that finished before `finishedBefore`.
+func (repo *Repo) DeleteFinishedJobs(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	ctx = database.WithQueryName(ctx, "DeleteFinishedJobs")
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM jobs WHERE status IN ('succeeded', 'failed') AND finished_at<$1;`, finishedBefore)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := res.RowsAffected()
+	return n, translateError(err)
+}
+
+// RequeueJob runs a failed job again as soon as possible, with its attempts reset. It fails with ErrJobNotFound if there is no failed job with the id, and with ErrJobAlreadyQueued if another job with the same unique key has been queued since.
+func (repo *Repo) RequeueJob(ctx context.Context, jobId string) error {
+	ctx = database.WithQueryName(ctx, "RequeueJob")
+	result, err := repo.db.ExecContext(ctx, `UPDATE jobs SET status='pending', attempts=0, run_at=current_timestamp, finished_at=NULL WHERE id=$1 AND status='failed';`, jobId)
+	if err = translateError(err); errors.Is(err, ErrUniqueViolation) {
+		return ErrJobAlreadyQueued
+	} else if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+func (repo *Repo) GetJobById(ctx context.Context, jobId string) (*Job, error) {
+	ctx = database.WithQueryName(ctx, "GetJobById")
+	job := new(Job)
+	err := scanJob(repo.reader(ctx).QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id=$1;`, jobId), job)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return job, nil
+}
+
+type JobFilter struct {
+	Status string
+	Kind   string
+	Cursor string
+	Limit  int
+}
+
+// GetJobs returns jobs matching the filter, newest first, and the cursor of the next page. The cursor is empty on the last page.
+func (repo *Repo) GetJobs(ctx context.Context, filter *JobFilter) ([]Job, string, error) {
+	ctx = database.WithQueryName(ctx, "GetJobs")
+	var conditions []string
+	var params []any
+
+	addCondition := func(format string, value any) {
+		params = append(params, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(params)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status=$%d", filter.Status)
+	}
+	if filter.Kind != "" {
+		addCondition("kind=$%d", filter.Kind)
+	}
+	if filter.Cursor != "" {
+		lastId, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", translateError(err)
+		}
+		addCondition("id<$%d", lastId)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultJobsLimit
+	}
+	limit = min(limit, maxJobsLimit)
+
+	query := "SELECT " + jobColumns + " FROM jobs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page.
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d;", limit+1)
+
+	rows, err := repo.reader(ctx).QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, "", translateError(err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var job Job
+		if err = scanJob(rows, &job); err != nil {
+			return nil, "", translateError(err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", translateError(err)
+	}
+
+	var nextCursor string
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		nextCursor = encodeCursor(jobs[limit-1].Id)
+	}
+	return jobs, nextCursor, nil
+}
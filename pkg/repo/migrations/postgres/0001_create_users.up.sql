@@ -0,0 +1,17 @@
+CREATE EXTENSION IF NOT EXISTS CITEXT;
+
+CREATE TABLE IF NOT EXISTS users(
+    id TEXT PRIMARY KEY,
+    role TEXT CHECK (role IN ('user', 'admin')) DEFAULT 'user',
+    email CITEXT NOT NULL UNIQUE CHECK (LENGTH(email)<=64),
+    password_hash TEXT NOT NULL CHECK (LENGTH(password_hash)<=72),
+    username TEXT UNIQUE CHECK (LENGTH(username)<=32) DEFAULT '',
+    full_name TEXT CHECK (LENGTH(full_name)<=64) DEFAULT '',
+    date_of_birth DATE,
+    gender TEXT CHECK (gender IN ('male', 'female', 'other')),
+    phone_number TEXT CHECK (LENGTH(phone_number)<=16),
+    account_status TEXT CHECK (account_status IN ('active', 'suspended', 'banned')) DEFAULT 'active',
+    image_url TEXT,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    updated_at TIMESTAMPTZ DEFAULT current_timestamp
+);
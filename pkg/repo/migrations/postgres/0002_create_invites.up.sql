@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invites(
+    id TEXT PRIMARY KEY,
+    email CITEXT NOT NULL CHECK (LENGTH(email)<=64),
+    role TEXT CHECK (role IN ('user', 'admin')) DEFAULT 'user',
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    consumed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp
+);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS organizations(
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL CHECK (LENGTH(name)<=64),
+    slug CITEXT NOT NULL UNIQUE CHECK (LENGTH(slug)<=32),
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    updated_at TIMESTAMPTZ DEFAULT current_timestamp
+);
+
+CREATE TABLE IF NOT EXISTS memberships(
+    org_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('member', 'admin', 'owner')) DEFAULT 'member',
+    created_at TIMESTAMPTZ DEFAULT current_timestamp,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS memberships_user_id_idx ON memberships(user_id);
+
+CREATE TABLE IF NOT EXISTS org_invitations(
+    id TEXT PRIMARY KEY,
+    org_id TEXT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email CITEXT NOT NULL CHECK (LENGTH(email)<=64),
+    role TEXT NOT NULL CHECK (role IN ('member', 'admin')) DEFAULT 'member',
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT current_timestamp
+);
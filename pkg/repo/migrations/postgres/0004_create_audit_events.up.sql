@@ -0,0 +1,26 @@
+-- audit_events is append-only, updates and deletes are rejected by a trigger.
+CREATE TABLE IF NOT EXISTS audit_events(
+    id TEXT PRIMARY KEY,
+    actor_id TEXT,
+    target_id TEXT,
+    action TEXT NOT NULL CHECK (LENGTH(action)<=64),
+    ip TEXT,
+    user_agent TEXT,
+    request_id TEXT,
+    metadata JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events(actor_id, id);
+
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events(target_id, id);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
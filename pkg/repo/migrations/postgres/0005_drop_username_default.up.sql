@@ -0,0 +1,4 @@
+-- An empty default username made every user after the first violate the unique constraint.
+ALTER TABLE users ALTER COLUMN username DROP DEFAULT;
+
+UPDATE users SET username=NULL WHERE username='';
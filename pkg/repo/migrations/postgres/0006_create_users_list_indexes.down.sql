@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS users_username_prefix_idx;
+
+DROP INDEX IF EXISTS users_email_prefix_idx;
+
+DROP INDEX IF EXISTS users_created_at_idx;
+
+DROP INDEX IF EXISTS users_account_status_id_idx;
+
+DROP INDEX IF EXISTS users_role_id_idx;
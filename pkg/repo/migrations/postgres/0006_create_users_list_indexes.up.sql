@@ -0,0 +1,11 @@
+-- Indexes for listing users. Filtered listings are ordered by id, so the filter columns are paired with it.
+CREATE INDEX IF NOT EXISTS users_role_id_idx ON users(role, id);
+
+CREATE INDEX IF NOT EXISTS users_account_status_id_idx ON users(account_status, id);
+
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users(created_at);
+
+-- text_pattern_ops lets prefix LIKE searches use the index regardless of the collation.
+CREATE INDEX IF NOT EXISTS users_email_prefix_idx ON users(lower(email::text) text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS users_username_prefix_idx ON users(lower(username) text_pattern_ops);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users_email_key;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
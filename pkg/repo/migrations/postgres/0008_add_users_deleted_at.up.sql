@@ -0,0 +1,6 @@
+-- Soft deleted users keep their row until purged. Only users that are not deleted need unique emails, so that a deleted address can sign up again.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users(email) WHERE deleted_at IS NULL;
@@ -0,0 +1,8 @@
+-- Encrypted values must be decrypted before reverting this migration.
+DROP INDEX IF EXISTS users_phone_number_hash_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS phone_number_hash;
+
+ALTER TABLE users ADD CONSTRAINT users_phone_number_check CHECK (LENGTH(phone_number)<=16);
+
+ALTER TABLE users ALTER COLUMN date_of_birth TYPE DATE USING date_of_birth::date;
@@ -0,0 +1,9 @@
+-- phone_number and date_of_birth hold ciphertext when a keyring is configured, so they become unconstrained text.
+ALTER TABLE users ALTER COLUMN date_of_birth TYPE TEXT USING date_of_birth::text;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_phone_number_check;
+
+-- phone_number_hash is the blind index of phone_number, an HMAC that allows exact-match lookups of the encrypted value.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_number_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS users_phone_number_hash_idx ON users(phone_number_hash);
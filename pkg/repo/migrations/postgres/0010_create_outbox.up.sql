@@ -0,0 +1,16 @@
+-- outbox holds domain events written in the same transaction as the change they describe, until the relay has delivered them.
+CREATE TABLE IF NOT EXISTS outbox(
+    id TEXT PRIMARY KEY,
+    topic TEXT NOT NULL CHECK (LENGTH(topic)<=64),
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    delivered_at TIMESTAMPTZ,
+    dead_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox(available_at, id) WHERE delivered_at IS NULL AND dead_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS outbox_dead_idx ON outbox(id) WHERE dead_at IS NOT NULL;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS jobs(
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (LENGTH(kind)<=64),
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'succeeded', 'failed')),
+    unique_key TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5 CHECK (max_attempts>0),
+    last_error TEXT,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+    finished_at TIMESTAMPTZ
+);
+
+-- Only one job of a kind with the same unique key can be queued or running at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON jobs(kind, unique_key) WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
+
+CREATE INDEX IF NOT EXISTS jobs_pending_idx ON jobs(run_at, id) WHERE status='pending';
+
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs(locked_until) WHERE status='running';
+
+CREATE INDEX IF NOT EXISTS jobs_status_idx ON jobs(status, id);
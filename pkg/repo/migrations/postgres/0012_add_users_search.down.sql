@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS users_email_trgm_idx;
+
+DROP INDEX IF EXISTS users_username_trgm_idx;
+
+DROP INDEX IF EXISTS users_full_name_trgm_idx;
+
+DROP INDEX IF EXISTS users_search_vector_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,17 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- search_vector holds the words of the searchable columns for full-text search. Names are weighted above emails. Phone numbers are not included, as they may be encrypted.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', COALESCE(full_name, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(username, '')), 'A') ||
+    setweight(to_tsvector('simple', email::text), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN(search_vector);
+
+-- Trigram indexes for fuzzy matching of misspelled and partial words.
+CREATE INDEX IF NOT EXISTS users_full_name_trgm_idx ON users USING GIN(lower(full_name) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING GIN(lower(username) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN(lower(email::text) gin_trgm_ops);
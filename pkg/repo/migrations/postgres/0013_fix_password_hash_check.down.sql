@@ -0,0 +1,2 @@
+-- The constraint on email is not restored, as it was a bug. 0001 now creates the constraint on password_hash.
+SELECT 1;
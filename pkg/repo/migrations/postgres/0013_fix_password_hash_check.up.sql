@@ -0,0 +1,14 @@
+-- 0001 checked the length of email instead of password_hash in the constraint of password_hash. Its generated name is not known, so it is found by its definition.
+DO $$
+DECLARE
+    constraint_name TEXT;
+BEGIN
+    FOR constraint_name IN SELECT conname FROM pg_constraint WHERE conrelid='users'::regclass AND contype='c' AND pg_get_constraintdef(oid) LIKE '%length(%email%<= 72)%' LOOP
+        EXECUTE format('ALTER TABLE users DROP CONSTRAINT %I', constraint_name);
+    END LOOP;
+END $$;
+
+-- Databases created after 0001 was fixed already have the constraint.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_password_hash_check;
+
+ALTER TABLE users ADD CONSTRAINT users_password_hash_check CHECK (LENGTH(password_hash)<=72);
@@ -0,0 +1,16 @@
+-- NOCASE gives the email column the case-insensitive semantics of CITEXT for ASCII addresses.
+CREATE TABLE IF NOT EXISTS users(
+    id TEXT PRIMARY KEY,
+    role TEXT CHECK (role IN ('user', 'admin')) DEFAULT 'user',
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (LENGTH(email)<=64),
+    password_hash TEXT NOT NULL CHECK (LENGTH(password_hash)<=72),
+    username TEXT UNIQUE CHECK (LENGTH(username)<=32),
+    full_name TEXT CHECK (LENGTH(full_name)<=64) DEFAULT '',
+    date_of_birth TEXT,
+    gender TEXT CHECK (gender IN ('male', 'female', 'other')),
+    phone_number TEXT CHECK (LENGTH(phone_number)<=16),
+    account_status TEXT CHECK (account_status IN ('active', 'suspended', 'banned')) DEFAULT 'active',
+    image_url TEXT,
+    created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    updated_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
@@ -0,0 +1,2 @@
+-- version is incremented on every update of a user, for optimistic concurrency control.
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
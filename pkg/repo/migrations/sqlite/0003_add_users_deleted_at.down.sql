@@ -0,0 +1,23 @@
+CREATE TABLE users_new(
+    id TEXT PRIMARY KEY,
+    role TEXT CHECK (role IN ('user', 'admin')) DEFAULT 'user',
+    email TEXT NOT NULL UNIQUE COLLATE NOCASE CHECK (LENGTH(email)<=64),
+    password_hash TEXT NOT NULL CHECK (LENGTH(password_hash)<=72),
+    username TEXT UNIQUE CHECK (LENGTH(username)<=32),
+    full_name TEXT CHECK (LENGTH(full_name)<=64) DEFAULT '',
+    date_of_birth TEXT,
+    gender TEXT CHECK (gender IN ('male', 'female', 'other')),
+    phone_number TEXT CHECK (LENGTH(phone_number)<=16),
+    account_status TEXT CHECK (account_status IN ('active', 'suspended', 'banned')) DEFAULT 'active',
+    image_url TEXT,
+    created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    updated_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO users_new(id, role, email, password_hash, username, full_name, date_of_birth, gender, phone_number, account_status, image_url, created_at, updated_at, version)
+SELECT id, role, email, password_hash, username, full_name, date_of_birth, gender, phone_number, account_status, image_url, created_at, updated_at, version FROM users WHERE deleted_at IS NULL;
+
+DROP TABLE users;
+
+ALTER TABLE users_new RENAME TO users;
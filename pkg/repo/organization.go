@@ -0,0 +1,183 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+)
+
+var (
+	ErrOrganizationNotFound  = errors.New("organization not found")
+	ErrMembershipNotFound    = errors.New("membership not found")
+	ErrOrgInvitationInvalid  = errors.New("organization invitation is invalid or expired")
+	ErrOrgInvitationNotFound = errors.New("organization invitation not found")
+)
+
+/*----------------------------------- Organization Type ----------------------------------- */
+
+type Organization struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	CreatedBy string `json:"created_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type Membership struct {
+	OrgId     string `json:"org_id"`
+	UserId    string `json:"user_id"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+}
+
+type OrgInvitation struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Id        string    `json:"id"`
+	OrgId     string    `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by,omitempty"`
+}
+
+// CreateOrganization creates an organization and makes the given user its owner.
+func (repo *Repo) CreateOrganization(ctx context.Context, org *Organization, ownerId string) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateOrganization")
+	orgId := id.New(id.Organization)
+	err := repo.db.QueryRowContext(ctx, `WITH org AS (INSERT INTO organizations(id, name, slug, created_by) VALUES($1, $2, $3, $4) RETURNING id) INSERT INTO memberships(org_id, user_id, role) SELECT id, $4, 'owner' FROM org RETURNING org_id;`, orgId, org.Name, org.Slug, ownerId).Scan(&orgId)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return orgId, nil
+}
+
+func (repo *Repo) GetOrganizationById(ctx context.Context, orgId string) (*Organization, error) {
+	ctx = database.WithQueryName(ctx, "GetOrganizationById")
+	org := new(Organization)
+	err := repo.reader(ctx).QueryRowContext(ctx, `SELECT id, name, slug, COALESCE(created_by, ''), created_at, updated_at FROM organizations WHERE id=$1 LIMIT 1;`, orgId).Scan(&org.Id, &org.Name, &org.Slug, &org.CreatedBy, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, translateError(err)
+	}
+	return org, nil
+}
+
+// GetOrganizationsByUserId returns the organizations the user is a member of.
+func (repo *Repo) GetOrganizationsByUserId(ctx context.Context, userId string) ([]Organization, error) {
+	ctx = database.WithQueryName(ctx, "GetOrganizationsByUserId")
+	rows, err := repo.reader(ctx).QueryContext(ctx, `SELECT o.id, o.name, o.slug, COALESCE(o.created_by, ''), o.created_at, o.updated_at FROM organizations o JOIN memberships m ON m.org_id=o.id WHERE m.user_id=$1 ORDER BY o.id;`, userId)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		var org Organization
+		if err = rows.Scan(&org.Id, &org.Name, &org.Slug, &org.CreatedBy, &org.CreatedAt, &org.UpdatedAt); err != nil {
+			return nil, translateError(err)
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, translateError(rows.Err())
+}
+
+// GetMembership reads from the primary, as it is used for authorization and must not see a stale role.
+func (repo *Repo) GetMembership(ctx context.Context, orgId string, userId string) (*Membership, error) {
+	ctx = database.WithQueryName(ctx, "GetMembership")
+	m := new(Membership)
+	err := repo.db.QueryRowContext(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id=$1 AND user_id=$2 LIMIT 1;`, orgId, userId).Scan(&m.OrgId, &m.UserId, &m.Role, &m.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMembershipNotFound
+		}
+		return nil, translateError(err)
+	}
+	return m, nil
+}
+
+func (repo *Repo) GetMembershipsByOrgId(ctx context.Context, orgId string) ([]Membership, error) {
+	ctx = database.WithQueryName(ctx, "GetMembershipsByOrgId")
+	rows, err := repo.reader(ctx).QueryContext(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id=$1 ORDER BY created_at;`, orgId)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	memberships := []Membership{}
+	for rows.Next() {
+		var m Membership
+		if err = rows.Scan(&m.OrgId, &m.UserId, &m.Role, &m.CreatedAt); err != nil {
+			return nil, translateError(err)
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, translateError(rows.Err())
+}
+
+func (repo *Repo) UpdateMembershipRole(ctx context.Context, orgId string, userId string, role string) error {
+	ctx = database.WithQueryName(ctx, "UpdateMembershipRole")
+	res, err := repo.db.ExecContext(ctx, `UPDATE memberships SET role=$3 WHERE org_id=$1 AND user_id=$2;`, orgId, userId, role)
+	if err != nil {
+		return translateError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMembershipNotFound
+	}
+	return nil
+}
+
+func (repo *Repo) DeleteMembership(ctx context.Context, orgId string, userId string) error {
+	ctx = database.WithQueryName(ctx, "DeleteMembership")
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM memberships WHERE org_id=$1 AND user_id=$2;`, orgId, userId)
+	if err != nil {
+		return translateError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMembershipNotFound
+	}
+	return nil
+}
+
+// CreateOrgInvitation stores an invitation to join an organization. Only the hash of the invitation token is persisted.
+func (repo *Repo) CreateOrgInvitation(ctx context.Context, invitation *OrgInvitation, tokenHash string) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateOrgInvitation")
+	invitationId := id.New(id.Invite)
+	err := repo.db.QueryRowContext(ctx, `INSERT INTO org_invitations(id, org_id, email, role, token_hash, invited_by, expires_at) VALUES($1, $2, $3, COALESCE(NULLIF($4, ''), 'member'), $5, NULLIF($6, ''), $7) RETURNING id;`, invitationId, invitation.OrgId, invitation.Email, invitation.Role, tokenHash, invitation.InvitedBy, invitation.ExpiresAt).Scan(&invitationId)
+	if err != nil {
+		return "", translateError(err)
+	}
+	return invitationId, nil
+}
+
+func (repo *Repo) DeleteOrgInvitation(ctx context.Context, orgId string, invitationId string) error {
+	ctx = database.WithQueryName(ctx, "DeleteOrgInvitation")
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM org_invitations WHERE org_id=$1 AND id=$2;`, orgId, invitationId)
+	if err != nil {
+		return translateError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOrgInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptOrgInvitation marks the invitation addressed to the given email as accepted and adds the user to the organization with the invited role. Existing members keep their role unless the invitation promotes them from member to admin, so that owners and admins cannot be demoted by accepting an invitation.
+func (repo *Repo) AcceptOrgInvitation(ctx context.Context, tokenHash string, userId string, email string) (*Membership, error) {
+	ctx = database.WithQueryName(ctx, "AcceptOrgInvitation")
+	m := new(Membership)
+	err := repo.db.QueryRowContext(ctx, `WITH inv AS (UPDATE org_invitations SET accepted_at=current_timestamp WHERE token_hash=$1 AND email=$3 AND accepted_at IS NULL AND expires_at>current_timestamp RETURNING org_id, role) INSERT INTO memberships(org_id, user_id, role) SELECT org_id, $2, role FROM inv ON CONFLICT (org_id, user_id) DO UPDATE SET role=CASE WHEN memberships.role='member' THEN EXCLUDED.role ELSE memberships.role END RETURNING org_id, user_id, role, created_at;`, tokenHash, userId, email).Scan(&m.OrgId, &m.UserId, &m.Role, &m.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrgInvitationInvalid
+		}
+		return nil, translateError(err)
+	}
+	return m, nil
+}
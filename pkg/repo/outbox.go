@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+)
+
+// Outbox event topics.
+const (
+	EventUserCreated         = "user.created"
+	EventUserPasswordChanged = "user.password_changed"
+)
+
+// DeliveredOutboxEventRetention is how long delivered events are kept, after which DeleteDeliveredOutboxEvents deletes them.
+const DeliveredOutboxEventRetention = time.Hour * 24 * 7
+
+/*----------------------------------- Outbox Event Type ----------------------------------- */
+
+type OutboxEvent struct {
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+	Id        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	// Attempts is the number of delivery attempts, including the current one.
+	Attempts int `json:"-"`
+}
+
+// CreateOutboxEvent adds an event with the JSON encoded `payload` to the outbox. Call it inside WithTx along with the change the event describes, so that the event is published if and only if the change is committed.
+func (repo *Repo) CreateOutboxEvent(ctx context.Context, topic string, payload any) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateOutboxEvent")
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", translateError(err)
+	}
+	eventId := id.New(id.OutboxEvent)
+	if _, err = repo.db.ExecContext(ctx, `INSERT INTO outbox(id, topic, payload) VALUES($1, $2, $3);`, eventId, topic, data); err != nil {
+		return "", translateError(err)
+	}
+	return eventId, nil
+}
+
+// ClaimOutboxEvents claims up to `limit` pending events for delivery and counts the attempt. Claimed events are hidden from other relays for `lease`, after which they are claimed again unless they have been marked as delivered, retried or dead-lettered. Rows locked by other relays are skipped.
+func (repo *Repo) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	ctx = database.WithQueryName(ctx, "ClaimOutboxEvents")
+	rows, err := repo.db.QueryContext(ctx, `WITH claimed AS (SELECT id FROM outbox WHERE delivered_at IS NULL AND dead_at IS NULL AND available_at<=current_timestamp ORDER BY available_at, id LIMIT $1 FOR UPDATE SKIP LOCKED)
+UPDATE outbox SET attempts=attempts+1, available_at=current_timestamp+$2*interval '1 second' FROM claimed WHERE outbox.id=claimed.id RETURNING outbox.id, outbox.topic, outbox.payload, outbox.attempts, outbox.created_at;`, limit, lease.Seconds())
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		if err = rows.Scan(&event.Id, &event.Topic, &event.Payload, &event.Attempts, &event.CreatedAt); err != nil {
+			return nil, translateError(err)
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return events, nil
+}
+
+func (repo *Repo) MarkOutboxEventDelivered(ctx context.Context, eventId string) error {
+	ctx = database.WithQueryName(ctx, "MarkOutboxEventDelivered")
+	_, err := repo.db.ExecContext(ctx, `UPDATE outbox SET delivered_at=current_timestamp, last_error=NULL WHERE id=$1;`, eventId)
+	return translateError(err)
+}
+
+// DeleteDeliveredOutboxEvents deletes the events delivered before `deliveredBefore`.
+func (repo *Repo) DeleteDeliveredOutboxEvents(ctx context.Context, deliveredBefore time.Time) (int64, error) {
+	ctx = database.WithQueryName(ctx, "DeleteDeliveredOutboxEvents")
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM outbox WHERE delivered_at<$1;`, deliveredBefore)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := res.RowsAffected()
+	return n, translateError(err)
+}
+
+// RetryOutboxEvent records a failed delivery attempt and makes the event available again at `retryAt`.
+func (repo *Repo) RetryOutboxEvent(ctx context.Context, eventId string, lastError string, retryAt time.Time) error {
+	ctx = database.WithQueryName(ctx, "RetryOutboxEvent")
+	_, err := repo.db.ExecContext(ctx, `UPDATE outbox SET last_error=$2, available_at=$3 WHERE id=$1;`, eventId, lastError, retryAt)
+	return translateError(err)
+}
+
+// DeadLetterOutboxEvent records a failed delivery attempt and stops delivering the event. Dead-lettered events stay in the outbox for inspection and can be redelivered using RequeueDeadOutboxEvents.
+func (repo *Repo) DeadLetterOutboxEvent(ctx context.Context, eventId string, lastError string) error {
+	ctx = database.WithQueryName(ctx, "DeadLetterOutboxEvent")
+	_, err := repo.db.ExecContext(ctx, `UPDATE outbox SET last_error=$2, dead_at=current_timestamp WHERE id=$1;`, eventId, lastError)
+	return translateError(err)
+}
+
+// RequeueDeadOutboxEvents makes all dead-lettered events pending again with their attempts reset, for example after fixing a sink, and returns how many there were.
+func (repo *Repo) RequeueDeadOutboxEvents(ctx context.Context) (int64, error) {
+	ctx = database.WithQueryName(ctx, "RequeueDeadOutboxEvents")
+	result, err := repo.db.ExecContext(ctx, `UPDATE outbox SET dead_at=NULL, attempts=0, available_at=current_timestamp WHERE dead_at IS NOT NULL;`)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := result.RowsAffected()
+	return n, translateError(err)
+}
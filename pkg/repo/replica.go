@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// ReplicaPicker picks the read replica to run a read-only query on. It is implemented by *database.ReplicaPool.
+type ReplicaPicker interface {
+	// Pick returns a healthy replica, or nil if all replicas are down.
+	Pick() *sql.DB
+	// MarkDown reports that a replica could not be reached.
+	MarkDown(db *sql.DB)
+}
+
+// WithReplicas routes read-only queries, such as GetUserById and ListUsers, to the replicas picked by `replicas`. Reads go to the primary inside transactions, when all replicas are down, and after a write in a ReadYourWrites context.
+func WithReplicas(replicas ReplicaPicker) func(*repoOpts) {
+	return func(ro *repoOpts) {
+		ro.replicas = replicas
+	}
+}
+
+type readYourWritesKey struct{}
+
+// ReadYourWrites returns a context in which reads go to the primary once a write has been made with it, so that they see the write despite replication lag. Use it for the context of each request.
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, new(atomic.Bool))
+}
+
+func markWritten(ctx context.Context) {
+	if written, ok := ctx.Value(readYourWritesKey{}).(*atomic.Bool); ok {
+		written.Store(true)
+	}
+}
+
+func hasWritten(ctx context.Context) bool {
+	written, ok := ctx.Value(readYourWritesKey{}).(*atomic.Bool)
+	return ok && written.Load()
+}
+
+// isWriteQuery reports whether a query may write. Only plain SELECT queries are considered reads.
+func isWriteQuery(query string) bool {
+	query = strings.TrimSpace(query)
+	return len(query) < 6 || !strings.EqualFold(query[:6], "SELECT")
+}
+
+// primaryDB wraps the primary database to record writes in ReadYourWrites contexts.
+type primaryDB struct {
+	dbtx
+}
+
+func (db primaryDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	markWritten(ctx)
+	return db.dbtx.ExecContext(ctx, query, args...)
+}
+
+func (db primaryDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if isWriteQuery(query) {
+		markWritten(ctx)
+	}
+	return db.dbtx.QueryContext(ctx, query, args...)
+}
+
+func (db primaryDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if isWriteQuery(query) {
+		markWritten(ctx)
+	}
+	return db.dbtx.QueryRowContext(ctx, query, args...)
+}
+
+// replicaDB runs queries on a replica, falling back to the primary if the replica cannot be reached.
+type replicaDB struct {
+	replica  *sql.DB
+	primary  dbtx
+	replicas ReplicaPicker
+}
+
+func (db replicaDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.primary.ExecContext(ctx, query, args...)
+}
+
+func (db replicaDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := db.replica.QueryContext(ctx, query, args...)
+	if isConnError(err) {
+		db.replicas.MarkDown(db.replica)
+		return db.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (db replicaDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	row := db.replica.QueryRowContext(ctx, query, args...)
+	if isConnError(row.Err()) {
+		db.replicas.MarkDown(db.replica)
+		return db.primary.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// isConnError reports whether err means that the database could not be reached.
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+// reader returns the database to run read-only queries on.
+func (repo *Repo) reader(ctx context.Context) dbtx {
+	if repo.replicas == nil || repo.tx != nil || hasWritten(ctx) {
+		return repo.db
+	}
+	replica := repo.replicas.Pick()
+	if replica == nil {
+		return repo.db
+	}
+	return replicaDB{replica: replica, primary: repo.db, replicas: repo.replicas}
+}
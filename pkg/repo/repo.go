@@ -2,21 +2,47 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"encoding/base64"
 	"errors"
+	"io/fs"
 
 	"github.com/rohitxdev/go-api-starter/internal/common"
 )
 
+//go:embed migrations
+var migrationsFS embed.FS
+
+var (
+	// Migrations contains the versioned SQL migrations of the postgres schema. Apply them using package migrate before calling New.
+	Migrations, _ = fs.Sub(migrationsFS, "migrations/postgres")
+	// SqliteMigrations contains the versioned SQL migrations of the sqlite schema. Apply them using package migrate before calling NewSqliteUserRepo.
+	SqliteMigrations, _ = fs.Sub(migrationsFS, "migrations/sqlite")
+)
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so that repo methods can run either directly on the database or inside a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Repo struct {
-	db    *sql.DB
-	stmts *Stmts
+	db    dbtx
+	sqlDB *sql.DB
+	// tx is set when the repo runs inside a transaction.
+	tx       *sql.Tx
+	stmts    *Stmts
+	keyring  *Keyring
+	replicas ReplicaPicker
 }
 
 func (s *Stmts) Close() error {
 	var errList []error
 
-	for _, stmt := range [...]common.Closer{s.CreateUserTable, s.GetUserById, s.GetUserByEmail, s.CreateUser, s.DeleteUserById} {
+	for _, stmt := range [...]common.Closer{s.CreateUser, s.DeleteUserById} {
 		if err := stmt.Close(); err != nil {
 			errList = append(errList, err)
 		}
@@ -26,75 +52,68 @@ func (s *Stmts) Close() error {
 }
 
 func (repo *Repo) Close() error {
+	if repo.tx != nil {
+		return errors.New("cannot close a repo inside a transaction")
+	}
 	if err := repo.stmts.Close(); err != nil {
 		return err
 	}
-	return repo.db.Close()
+	return repo.sqlDB.Close()
+}
+
+// stmt returns the prepared statement bound to the repo's transaction, if any.
+func (repo *Repo) stmt(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if repo.tx != nil {
+		return repo.tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+type repoOpts struct {
+	keyring  *Keyring
+	replicas ReplicaPicker
+}
+
+// WithKeyring makes the repo encrypt the PII columns of users with the keyring. Without it, they are stored in plaintext.
+func WithKeyring(keyring *Keyring) func(*repoOpts) {
+	return func(ro *repoOpts) {
+		ro.keyring = keyring
+	}
 }
 
-func New(db *sql.DB) *Repo {
+func New(db *sql.DB, optFuncs ...func(*repoOpts)) *Repo {
+	opts := repoOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
 	stmts, err := prepareStmts(db)
 	if err != nil {
 		panic(err)
 	}
 	return &Repo{
-		db:    db,
-		stmts: stmts,
+		db:       primaryDB{db},
+		sqlDB:    db,
+		stmts:    stmts,
+		keyring:  opts.keyring,
+		replicas: opts.replicas,
 	}
 }
 
-func (repo *Repo) Migrate() error {
-	if _, err := repo.db.Exec("CREATE EXTENSION IF NOT EXISTS CITEXT;"); err != nil {
-		return err
-	}
-	_, err := repo.stmts.CreateUserTable.Exec()
-	return err
-}
+// User reads are not prepared statements, as they may run on a replica.
+const (
+	getUserByIdQuery    = `SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at, version, deleted_at FROM users WHERE id=$1 AND ($2::boolean OR deleted_at IS NULL) LIMIT 1;`
+	getUserByEmailQuery = `SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at, version, deleted_at FROM users WHERE email=$1 AND ($2::boolean OR deleted_at IS NULL) ORDER BY deleted_at IS NULL DESC, deleted_at DESC LIMIT 1;`
+)
 
 type Stmts struct {
-	CreateUserTable *sql.Stmt
-	GetUserById     *sql.Stmt
-	GetUserByEmail  *sql.Stmt
-	CreateUser      *sql.Stmt
-	DeleteUserById  *sql.Stmt
-	Update          *sql.Stmt
+	CreateUser     *sql.Stmt
+	DeleteUserById *sql.Stmt
+	Update         *sql.Stmt
 }
 
 func prepareStmts(db *sql.DB) (*Stmts, error) {
 	stmts := Stmts{}
 
-	createUserTable, err := db.Prepare(`CREATE TABLE IF NOT EXISTS users(
-    id TEXT PRIMARY KEY,
-	role TEXT CHECK (role IN ('user', 'admin')) DEFAULT 'user',
-    email CITEXT NOT NULL UNIQUE CHECK (LENGTH(email)<=64),
-    password_hash TEXT NOT NULL CHECK (LENGTH(email)<=72),
-	username TEXT UNIQUE CHECK (LENGTH(username)<=32) DEFAULT '',
-    full_name TEXT CHECK (LENGTH(full_name)<=64) DEFAULT '',
-    date_of_birth DATE,
-    gender TEXT CHECK (gender IN ('male', 'female', 'other')),
-	phone_number TEXT CHECK (LENGTH(phone_number)<=16),
-	account_status TEXT CHECK (account_status IN ('active', 'suspended', 'banned')) DEFAULT 'active',
-	image_url TEXT,
-    created_at TIMESTAMPTZ DEFAULT current_timestamp,
-    updated_at TIMESTAMPTZ DEFAULT current_timestamp
-);`)
-	if err != nil {
-		return nil, err
-	}
-	stmts.CreateUserTable = createUserTable
-
-	getUserById, err := db.Prepare(`SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at FROM users WHERE id=$1 LIMIT 1;`)
-	if err != nil {
-		return nil, err
-	}
-	stmts.GetUserById = getUserById
-
-	getUserByEmail, err := db.Prepare(`SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at FROM users WHERE email=$1 LIMIT 1;`)
-	if err != nil {
-		return nil, err
-	}
-	stmts.GetUserByEmail = getUserByEmail
-
 	createUser, err := db.Prepare(`INSERT INTO users(id, email, password_hash) VALUES($1, $2, $3);`)
 	if err != nil {
 		return nil, err
@@ -109,3 +128,20 @@ func prepareStmts(db *sql.DB) (*Stmts, error) {
 
 	return &stmts, nil
 }
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// encodeCursor returns an opaque pagination cursor for a keyset value.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(key), nil
+}
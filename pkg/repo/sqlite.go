@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/id"
+)
+
+// SqliteUserRepo is a UserRepo backed by SQLite, for running without postgres in local development, demos and tests. It does not encrypt PII columns.
+type SqliteUserRepo struct {
+	db *sql.DB
+}
+
+// NewSqliteUserRepo returns a user repo backed by [db], which must be an sqlite database migrated with SqliteMigrations.
+func NewSqliteUserRepo(db *sql.DB) *SqliteUserRepo {
+	return &SqliteUserRepo{db: db}
+}
+
+func (repo *SqliteUserRepo) Close() error {
+	return repo.db.Close()
+}
+
+// sqliteNow is the current time in the format of the created_at and updated_at columns.
+const sqliteNow = `strftime('%Y-%m-%dT%H:%M:%fZ', 'now')`
+
+const sqliteSelectUser = `SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at, version, deleted_at FROM users`
+
+func (repo *SqliteUserRepo) getUser(ctx context.Context, where string, arg any, optFuncs []func(*queryOpts)) (*User, error) {
+	opts := newQueryOpts(optFuncs)
+	user := new(User)
+	err := repo.db.QueryRowContext(ctx, sqliteSelectUser+" WHERE "+where+" AND ($2 OR deleted_at IS NULL) ORDER BY deleted_at IS NULL DESC, deleted_at DESC LIMIT 1;", arg, opts.includeDeleted).Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.DeletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, translateError(err)
+	}
+	return user, nil
+}
+
+func (repo *SqliteUserRepo) GetUserById(ctx context.Context, userId string, optFuncs ...func(*queryOpts)) (*User, error) {
+	ctx = database.WithQueryName(ctx, "GetUserById")
+	return repo.getUser(ctx, "id=$1", userId, optFuncs)
+}
+
+func (repo *SqliteUserRepo) GetUserByEmail(ctx context.Context, email string, optFuncs ...func(*queryOpts)) (*User, error) {
+	ctx = database.WithQueryName(ctx, "GetUserByEmail")
+	return repo.getUser(ctx, "email=$1", email, optFuncs)
+}
+
+func (repo *SqliteUserRepo) CreateUser(ctx context.Context, user *UserCore) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateUser")
+	userId := id.New(id.User)
+	err := repo.db.QueryRowContext(ctx, `INSERT INTO users(id, email, password_hash, role) VALUES($1, $2, $3, COALESCE(NULLIF($4, ''), 'user')) RETURNING id;`, userId, user.Email, user.PasswordHash, user.Role).Scan(&userId)
+	if err != nil {
+		return "", translateUserError(err)
+	}
+	return userId, nil
+}
+
+func (repo *SqliteUserRepo) DeleteUserById(ctx context.Context, id string) error {
+	ctx = database.WithQueryName(ctx, "DeleteUserById")
+	_, err := repo.db.ExecContext(ctx, `DELETE FROM users WHERE id=$1;`, id)
+	return translateError(err)
+}
+
+func (repo *SqliteUserRepo) SoftDeleteUser(ctx context.Context, id string) error {
+	ctx = database.WithQueryName(ctx, "SoftDeleteUser")
+	return softDeleteUser(ctx, repo.db, sqliteNow, id)
+}
+
+func (repo *SqliteUserRepo) RestoreUser(ctx context.Context, id string) error {
+	ctx = database.WithQueryName(ctx, "RestoreUser")
+	return restoreUser(ctx, repo.db, sqliteNow, id)
+}
+
+func (repo *SqliteUserRepo) Update(ctx context.Context, id string, updates map[string]any, optFuncs ...func(*updateOpts)) error {
+	ctx = database.WithQueryName(ctx, "Update")
+	return updateUser(ctx, repo.db, sqliteNow, nil, id, updates, optFuncs...)
+}
@@ -0,0 +1,130 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSqliteUserRepo(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := database.NewSqlite(":memory:")
+	assert.Nil(t, err)
+
+	m, err := migrate.New(db, repo.SqliteMigrations, migrate.WithDialect(migrate.SQLite))
+	assert.Nil(t, err)
+	assert.Nil(t, m.Up(ctx, 0))
+
+	r := repo.NewSqliteUserRepo(db)
+	defer r.Close()
+
+	var userId string
+
+	t.Run("Create user", func(t *testing.T) {
+		userId, err = r.CreateUser(ctx, &repo.UserCore{Email: "Test@Test.com", PasswordHash: "testpassword"})
+		assert.Nil(t, err)
+		assert.NotEqual(t, userId, "")
+
+		_, err = r.CreateUser(ctx, &repo.UserCore{Email: "other@test.com", PasswordHash: "testpassword", Role: "admin"})
+		assert.Nil(t, err)
+	})
+
+	t.Run("Reject duplicate email ignoring case", func(t *testing.T) {
+		_, err := r.CreateUser(ctx, &repo.UserCore{Email: "test@TEST.com", PasswordHash: "testpassword"})
+		assert.ErrorIs(t, err, repo.ErrUserAlreadyExists)
+		assert.ErrorIs(t, err, repo.ErrUniqueViolation)
+
+		var repoErr *repo.Error
+		if assert.ErrorAs(t, err, &repoErr) {
+			assert.Equal(t, "users", repoErr.Table)
+			assert.Equal(t, "email", repoErr.Column)
+		}
+	})
+
+	t.Run("Reject null password hash", func(t *testing.T) {
+		err := r.Update(ctx, userId, map[string]any{"password_hash": nil})
+		assert.ErrorIs(t, err, repo.ErrNotNullViolation)
+	})
+
+	t.Run("Get user by email ignoring case", func(t *testing.T) {
+		user, err := r.GetUserByEmail(ctx, "test@test.COM")
+		assert.Nil(t, err)
+		assert.Equal(t, userId, user.Id)
+		assert.Equal(t, "user", user.Role)
+		assert.Equal(t, "active", user.AccountStatus)
+	})
+
+	t.Run("Update user", func(t *testing.T) {
+		assert.Nil(t, r.Update(ctx, userId, map[string]any{"full_name": "Test User"}))
+
+		user, err := r.GetUserById(ctx, userId)
+		assert.Nil(t, err)
+		assert.Equal(t, "Test User", user.FullName)
+	})
+
+	t.Run("Update user at expected version", func(t *testing.T) {
+		user, err := r.GetUserById(ctx, userId)
+		assert.Nil(t, err)
+
+		assert.Nil(t, r.Update(ctx, userId, map[string]any{"full_name": "First"}, repo.WithExpectedVersion(user.Version)))
+
+		err = r.Update(ctx, userId, map[string]any{"full_name": "Second"}, repo.WithExpectedVersion(user.Version))
+		assert.ErrorIs(t, err, repo.ErrVersionConflict)
+
+		updated, err := r.GetUserById(ctx, userId)
+		assert.Nil(t, err)
+		assert.Equal(t, "First", updated.FullName)
+		assert.Equal(t, user.Version+1, updated.Version)
+
+		err = r.Update(ctx, "usr_unknown", map[string]any{"full_name": "Nobody"}, repo.WithExpectedVersion(1))
+		assert.ErrorIs(t, err, repo.ErrUserNotFound)
+	})
+
+	t.Run("Soft delete and restore user", func(t *testing.T) {
+		assert.Nil(t, r.SoftDeleteUser(ctx, userId))
+		assert.ErrorIs(t, r.SoftDeleteUser(ctx, userId), repo.ErrUserNotFound)
+
+		_, err := r.GetUserById(ctx, userId)
+		assert.ErrorIs(t, err, repo.ErrUserNotFound)
+		_, err = r.GetUserByEmail(ctx, "test@test.com")
+		assert.ErrorIs(t, err, repo.ErrUserNotFound)
+
+		deleted, err := r.GetUserById(ctx, userId, repo.IncludeDeleted())
+		assert.Nil(t, err)
+		assert.NotNil(t, deleted.DeletedAt)
+
+		assert.Nil(t, r.RestoreUser(ctx, userId))
+		assert.ErrorIs(t, r.RestoreUser(ctx, userId), repo.ErrUserNotFound)
+
+		restored, err := r.GetUserById(ctx, userId)
+		assert.Nil(t, err)
+		assert.Nil(t, restored.DeletedAt)
+	})
+
+	t.Run("Register email of deleted user again", func(t *testing.T) {
+		assert.Nil(t, r.SoftDeleteUser(ctx, userId))
+
+		newUserId, err := r.CreateUser(ctx, &repo.UserCore{Email: "test@test.com", PasswordHash: "testpassword"})
+		assert.Nil(t, err)
+
+		user, err := r.GetUserByEmail(ctx, "test@test.com", repo.IncludeDeleted())
+		assert.Nil(t, err)
+		assert.Equal(t, newUserId, user.Id)
+
+		assert.ErrorIs(t, r.RestoreUser(ctx, userId), repo.ErrUserAlreadyExists)
+		assert.Nil(t, r.DeleteUserById(ctx, newUserId))
+		assert.Nil(t, r.RestoreUser(ctx, userId))
+	})
+
+	t.Run("Delete user", func(t *testing.T) {
+		assert.Nil(t, r.DeleteUserById(ctx, userId))
+
+		_, err := r.GetUserById(ctx, userId)
+		assert.ErrorIs(t, err, repo.ErrUserNotFound)
+	})
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultTxMaxAttempts = 3
+	txRetryBaseDelay     = time.Millisecond * 20
+)
+
+type txOpts struct {
+	isolation   sql.IsolationLevel
+	readOnly    bool
+	maxAttempts int
+}
+
+// WithIsolationLevel sets the isolation level of the transaction. The default is the database's default, which is read committed on postgres.
+func WithIsolationLevel(level sql.IsolationLevel) func(*txOpts) {
+	return func(to *txOpts) {
+		to.isolation = level
+	}
+}
+
+// WithReadOnly makes the transaction read-only.
+func WithReadOnly() func(*txOpts) {
+	return func(to *txOpts) {
+		to.readOnly = true
+	}
+}
+
+// WithMaxAttempts sets how many times the transaction is attempted in total when it fails with a serialization failure or a deadlock. The default is 3.
+func WithMaxAttempts(n int) func(*txOpts) {
+	return func(to *txOpts) {
+		to.maxAttempts = n
+	}
+}
+
+// WithTx runs `fn` in a transaction, passing it a repo whose methods run inside the transaction. The transaction is committed if `fn` returns nil and rolled back otherwise. On serialization failures and deadlocks (SQLSTATE 40001 and 40P01), the whole transaction including `fn` is retried with backoff, so `fn` must be safe to run more than once.
+//
+// Calling WithTx on a repo that is already inside a transaction runs `fn` in that transaction.
+func (repo *Repo) WithTx(ctx context.Context, fn func(tx *Repo) error, optFuncs ...func(*txOpts)) error {
+	if repo.tx != nil {
+		return fn(repo)
+	}
+
+	opts := txOpts{maxAttempts: defaultTxMaxAttempts}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	attempts := max(opts.maxAttempts, 1)
+	var err error
+	for attempt := range attempts {
+		if attempt > 0 {
+			// Exponential backoff with full jitter
+			delay := rand.N(txRetryBaseDelay << attempt)
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(delay):
+			}
+		}
+		if err = repo.runTx(ctx, fn, &opts); err == nil || !isRetryableTxError(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("transaction failed after %d attempts: %w", attempts, err)
+}
+
+func (repo *Repo) runTx(ctx context.Context, fn func(tx *Repo) error, opts *txOpts) error {
+	tx, err := repo.sqlDB.BeginTx(ctx, &sql.TxOptions{Isolation: opts.isolation, ReadOnly: opts.readOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txRepo := &Repo{
+		db:      primaryDB{tx},
+		sqlDB:   repo.sqlDB,
+		tx:      tx,
+		stmts:   repo.stmts,
+		keyring: repo.keyring,
+	}
+	if err = fn(txRepo); err != nil {
+		return err
+	}
+	return translateError(tx.Commit())
+}
+
+func isRetryableTxError(err error) bool {
+	err = translateError(err)
+	return errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock)
+}
@@ -5,14 +5,33 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/lib/pq"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
 	"github.com/rohitxdev/go-api-starter/pkg/id"
 )
 
 var (
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrUserNotFound      = errors.New("user not found")
+	// ErrVersionConflict is returned when a user was modified since the expected version was read.
+	ErrVersionConflict = errors.New("user has been modified")
+)
+
+// UserRepo is implemented by the postgres (Repo) and sqlite (SqliteUserRepo) user stores.
+type UserRepo interface {
+	GetUserById(ctx context.Context, userId string, optFuncs ...func(*queryOpts)) (*User, error)
+	GetUserByEmail(ctx context.Context, email string, optFuncs ...func(*queryOpts)) (*User, error)
+	CreateUser(ctx context.Context, user *UserCore) (string, error)
+	DeleteUserById(ctx context.Context, id string) error
+	SoftDeleteUser(ctx context.Context, id string) error
+	RestoreUser(ctx context.Context, id string) error
+	Update(ctx context.Context, id string, updates map[string]any, optFuncs ...func(*updateOpts)) error
+}
+
+var (
+	_ UserRepo = (*Repo)(nil)
+	_ UserRepo = (*SqliteUserRepo)(nil)
 )
 
 /*----------------------------------- User Type ----------------------------------- */
@@ -20,11 +39,11 @@ var (
 type UserCore struct {
 	Email        string `json:"email"`
 	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
 }
 
 type User struct {
 	UserCore
-	Role          string `json:"role"`
 	FullName      string `json:"full_name,omitempty"`
 	Username      string `json:"username,omitempty"`
 	DateOfBirth   string `json:"date_of_birth"`
@@ -35,65 +54,184 @@ type User struct {
 	CreatedAt     string `json:"created_at"`
 	UpdatedAt     string `json:"updated_at"`
 	Id            string `json:"id"`
+	// DeletedAt is set if the user has been soft deleted.
+	DeletedAt *string `json:"deleted_at,omitempty"`
+	// Version is incremented on every update.
+	Version int64 `json:"version"`
+}
+
+type queryOpts struct {
+	includeDeleted bool
 }
 
-func (repo *Repo) GetUserById(ctx context.Context, userId string) (*User, error) {
+// IncludeDeleted makes the query also return soft deleted users.
+func IncludeDeleted() func(*queryOpts) {
+	return func(qo *queryOpts) {
+		qo.includeDeleted = true
+	}
+}
+
+func newQueryOpts(optFuncs []func(*queryOpts)) queryOpts {
+	opts := queryOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return opts
+}
+
+func (repo *Repo) GetUserById(ctx context.Context, userId string, optFuncs ...func(*queryOpts)) (*User, error) {
+	ctx = database.WithQueryName(ctx, "GetUserById")
+	opts := newQueryOpts(optFuncs)
 	user := new(User)
-	err := repo.stmts.GetUserById.QueryRowContext(ctx, userId).Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt)
+	err := repo.reader(ctx).QueryRowContext(ctx, getUserByIdQuery, userId, opts.includeDeleted).Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.DeletedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
 		}
-		if err, ok := err.(*pq.Error); ok {
-			switch code := err.Code.Name(); code {
-			case "undefined_column":
-				return nil, ErrUserNotFound
-			default:
-				return nil, errors.New(code)
-			}
-		}
+		return nil, translateError(err)
+	}
+	if err = repo.keyring.decryptUser(user); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (repo *Repo) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+func (repo *Repo) GetUserByEmail(ctx context.Context, email string, optFuncs ...func(*queryOpts)) (*User, error) {
+	ctx = database.WithQueryName(ctx, "GetUserByEmail")
+	opts := newQueryOpts(optFuncs)
 	user := new(User)
-	err := repo.db.QueryRowContext(ctx, `SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at FROM users WHERE email=$1 LIMIT 1;`, email).Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt)
+	err := repo.reader(ctx).QueryRowContext(ctx, getUserByEmailQuery, email, opts.includeDeleted).Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.DeletedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrUserNotFound
 		}
-		if err, ok := err.(*pq.Error); ok {
-			switch code := err.Code.Name(); code {
-			case "undefined_column":
-				return nil, ErrUserNotFound
-			default:
-				return nil, errors.New(code)
-			}
-		}
+		return nil, translateError(err)
+	}
+	if err = repo.keyring.decryptUser(user); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
 func (repo *Repo) CreateUser(ctx context.Context, user *UserCore) (string, error) {
+	ctx = database.WithQueryName(ctx, "CreateUser")
 	userId := id.New(id.User)
-	err := repo.db.QueryRowContext(ctx, `INSERT INTO users(id, email, password_hash) VALUES($1, $2, $3) RETURNING id;`, userId, user.Email, user.PasswordHash).Scan(&userId)
+	err := repo.db.QueryRowContext(ctx, `INSERT INTO users(id, email, password_hash, role) VALUES($1, $2, $3, COALESCE(NULLIF($4, ''), 'user')) RETURNING id;`, userId, user.Email, user.PasswordHash, user.Role).Scan(&userId)
 	if err != nil {
-		return "", err
+		return "", translateUserError(err)
 	}
 	return userId, nil
 }
 
 func (repo *Repo) DeleteUserById(ctx context.Context, id string) error {
-	_, err := repo.stmts.DeleteUserById.ExecContext(ctx, id)
-	return err
+	ctx = database.WithQueryName(ctx, "DeleteUserById")
+	markWritten(ctx)
+	_, err := repo.stmt(ctx, repo.stmts.DeleteUserById).ExecContext(ctx, id)
+	return translateError(err)
+}
+
+// DeletedUserRetention is how long a soft deleted user can be restored, after which PurgeDeletedUsers deletes it.
+const DeletedUserRetention = time.Hour * 24 * 30
+
+// SoftDeleteUser marks the user as deleted. It is excluded from queries unless IncludeDeleted is used, and can be restored using RestoreUser.
+func (repo *Repo) SoftDeleteUser(ctx context.Context, id string) error {
+	ctx = database.WithQueryName(ctx, "SoftDeleteUser")
+	return softDeleteUser(ctx, repo.db, "current_timestamp", id)
+}
+
+// PurgeDeletedUsers permanently deletes the users that were soft deleted before `deletedBefore`, and returns how many there were.
+func (repo *Repo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx = database.WithQueryName(ctx, "PurgeDeletedUsers")
+	res, err := repo.db.ExecContext(ctx, `DELETE FROM users WHERE deleted_at<$1;`, deletedBefore)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := res.RowsAffected()
+	return n, translateError(err)
+}
+
+// RestoreUser undoes SoftDeleteUser. It fails with ErrUserAlreadyExists if the email has been registered again since.
+func (repo *Repo) RestoreUser(ctx context.Context, id string) error {
+	ctx = database.WithQueryName(ctx, "RestoreUser")
+	return restoreUser(ctx, repo.db, "current_timestamp", id)
+}
+
+func softDeleteUser(ctx context.Context, db dbtx, now string, id string) error {
+	res, err := db.ExecContext(ctx, fmt.Sprintf(`UPDATE users SET deleted_at=%[1]s, updated_at=%[1]s, version=version+1 WHERE id=$1 AND deleted_at IS NULL;`, now), id)
+	return checkUserAffected(res, err)
+}
+
+func restoreUser(ctx context.Context, db dbtx, now string, id string) error {
+	res, err := db.ExecContext(ctx, fmt.Sprintf(`UPDATE users SET deleted_at=NULL, updated_at=%s, version=version+1 WHERE id=$1 AND deleted_at IS NOT NULL;`, now), id)
+	return checkUserAffected(res, translateUserError(err))
 }
 
-func (repo *Repo) Update(ctx context.Context, id string, updates map[string]any) error {
+// checkUserAffected returns ErrUserNotFound if a statement on a single user affected no rows.
+func checkUserAffected(res sql.Result, err error) error {
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+type updateOpts struct {
+	version int64
+}
+
+// WithExpectedVersion makes the update fail with ErrVersionConflict unless the user is still at `version`.
+func WithExpectedVersion(version int64) func(*updateOpts) {
+	return func(uo *updateOpts) {
+		uo.version = version
+	}
+}
+
+func (repo *Repo) Update(ctx context.Context, id string, updates map[string]any, optFuncs ...func(*updateOpts)) error {
+	ctx = database.WithQueryName(ctx, "Update")
+	return updateUser(ctx, repo.db, "current_timestamp", repo.keyring, id, updates, optFuncs...)
+}
+
+// updateUser sets the columns in `updates` of the user with `id` and bumps its version. `now` is the SQL expression of the current time in the database's format. Encrypted columns are encrypted with `keyring`, if not nil.
+func updateUser(ctx context.Context, db dbtx, now string, keyring *Keyring, id string, updates map[string]any, optFuncs ...func(*updateOpts)) error {
+	opts := updateOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	updates, err := keyring.encryptUpdates(updates)
+	if err != nil {
+		return err
+	}
+
+	query, params := updateUserQuery(id, updates, now, opts.version)
+	res, err := db.ExecContext(ctx, query, params...)
+	if err != nil {
+		return translateUserError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return translateError(err)
+	}
+
+	var version int64
+	if err = db.QueryRowContext(ctx, `SELECT version FROM users WHERE id=$1 AND deleted_at IS NULL;`, id).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return translateError(err)
+	}
+	return ErrVersionConflict
+}
+
+// updateUserQuery builds the query that sets the columns in `updates` of the user with `id`, if it is at `version`. A zero `version` matches any version.
+func updateUserQuery(id string, updates map[string]any, now string, version int64) (string, []any) {
 	query := "UPDATE users SET "
 	var params []interface{}
 
@@ -104,11 +242,11 @@ func (repo *Repo) Update(ctx context.Context, id string, updates map[string]any)
 		count++
 	}
 
-	// Remove the trailing comma and space
-	query = query[:len(query)-2]
-
-	query += fmt.Sprintf(" WHERE id=$%v;", count)
+	query += fmt.Sprintf("updated_at=%s, version=version+1 WHERE id=$%v AND deleted_at IS NULL", now, count)
 	params = append(params, id)
-	_, err := repo.db.Exec(query, params...)
-	return err
+	if version != 0 {
+		query += fmt.Sprintf(" AND version=$%v", count+1)
+		params = append(params, version)
+	}
+	return query + ";", params
 }
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+)
+
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 200
+)
+
+type UserSort string
+
+const (
+	UserSortNewest UserSort = "newest"
+	UserSortOldest UserSort = "oldest"
+)
+
+// UserFilter filters the users returned by ListUsers. Zero values match all users.
+type UserFilter struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Role          string
+	AccountStatus string
+	// Search matches users whose email or username starts with it, ignoring case.
+	Search string
+	// Sort defaults to UserSortNewest.
+	Sort UserSort
+	// IncludeDeleted also matches soft deleted users.
+	IncludeDeleted bool
+}
+
+// Page selects a page of results. Cursor is the NextCursor of the previous page, or empty for the first page.
+type Page struct {
+	Cursor string
+	Limit  int
+	// WithTotal also counts all the results matching the filter, which costs an extra query.
+	WithTotal bool
+}
+
+type UserPage struct {
+	// Total is only set if requested using Page.WithTotal.
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	Users      []User `json:"users"`
+}
+
+// ListUsers returns a page of the users matching the filter. Users are ordered by id, which is time ordered, so pages stay stable while users are created.
+func (repo *Repo) ListUsers(ctx context.Context, filter *UserFilter, page *Page) (*UserPage, error) {
+	ctx = database.WithQueryName(ctx, "ListUsers")
+	var conditions []string
+	var params []any
+
+	addCondition := func(format string, value any) {
+		params = append(params, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(params)))
+	}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if filter.Role != "" {
+		addCondition("role=$%d", filter.Role)
+	}
+	if filter.AccountStatus != "" {
+		addCondition("account_status=$%d", filter.AccountStatus)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		addCondition("created_at>=$%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		addCondition("created_at<$%d", filter.CreatedBefore)
+	}
+	if filter.Search != "" {
+		// Matches the expression indexes on lower(email) and lower(username).
+		params = append(params, escapeLike(strings.ToLower(filter.Search))+"%")
+		conditions = append(conditions, fmt.Sprintf("(lower(email::text) LIKE $%[1]d OR lower(username) LIKE $%[1]d)", len(params)))
+	}
+
+	var total *int64
+	if page.WithTotal {
+		query := "SELECT COUNT(*) FROM users"
+		if len(conditions) > 0 {
+			query += " WHERE " + strings.Join(conditions, " AND ")
+		}
+		total = new(int64)
+		if err := repo.reader(ctx).QueryRowContext(ctx, query, params...).Scan(total); err != nil {
+			return nil, translateError(err)
+		}
+	}
+
+	order, cursorOp := "DESC", "<"
+	if filter.Sort == UserSortOldest {
+		order, cursorOp = "ASC", ">"
+	}
+	if page.Cursor != "" {
+		lastId, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		addCondition("id"+cursorOp+"$%d", lastId)
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = defaultUsersLimit
+	}
+	limit = min(limit, maxUsersLimit)
+
+	query := "SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at, version, deleted_at FROM users"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page.
+	query += fmt.Sprintf(" ORDER BY id %s LIMIT %d;", order, limit+1)
+
+	rows, err := repo.reader(ctx).QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.DeletedAt); err != nil {
+			return nil, translateError(err)
+		}
+		if err = repo.keyring.decryptUser(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	result := &UserPage{Users: users, Total: total}
+	if len(users) > limit {
+		result.Users = users[:limit]
+		result.NextCursor = encodeCursor(users[limit-1].Id)
+	}
+	return result, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
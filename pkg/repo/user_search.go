@@ -0,0 +1,254 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+)
+
+var (
+	ErrInvalidSearchQuery = errors.New("invalid search query")
+)
+
+// UserSearch is a parsed user search query. Zero values match all users.
+type UserSearch struct {
+	// Terms are matched against the full name, username and email of users, by word prefix and by similarity. Terms that look like phone numbers also match phone numbers exactly.
+	Terms         []string
+	Role          string
+	AccountStatus string
+	// PhoneNumber matches users with exactly this phone number.
+	PhoneNumber    string
+	IncludeDeleted bool
+}
+
+// ParseUserSearch parses a search query made of free text terms and `key:value` filters, such as `role:admin status:active john`. The filters are `role`, `status`, `phone` and `deleted` (true or false).
+func ParseUserSearch(query string) (*UserSearch, error) {
+	search := &UserSearch{}
+	for _, field := range strings.Fields(query) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			search.Terms = append(search.Terms, field)
+			continue
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%w: filter %q has no value", ErrInvalidSearchQuery, key)
+		}
+		switch strings.ToLower(key) {
+		case "role":
+			search.Role = value
+		case "status":
+			search.AccountStatus = value
+		case "phone":
+			search.PhoneNumber = value
+		case "deleted":
+			includeDeleted, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: deleted must be true or false", ErrInvalidSearchQuery)
+			}
+			search.IncludeDeleted = includeDeleted
+		default:
+			return nil, fmt.Errorf("%w: unknown filter %q", ErrInvalidSearchQuery, key)
+		}
+	}
+	return search, nil
+}
+
+type UserSearchResult struct {
+	User User `json:"user"`
+	// Highlights maps the matched fields (full_name, username and email) to their HTML escaped value, with the matched terms wrapped in <mark> tags.
+	Highlights map[string]string `json:"highlights,omitempty"`
+	Rank       float64           `json:"rank"`
+}
+
+type UserSearchPage struct {
+	NextCursor string             `json:"nextCursor,omitempty"`
+	Results    []UserSearchResult `json:"results"`
+}
+
+var phoneNumberRegex = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// SearchUsers returns a page of the users matching the search, best matches first. Users match if a term prefixes a word of their full name, username or email, or is similar to one of them, which tolerates typos. The cursor of the page is an offset, as results are ordered by rank.
+func (repo *Repo) SearchUsers(ctx context.Context, search *UserSearch, page *Page) (*UserSearchPage, error) {
+	ctx = database.WithQueryName(ctx, "SearchUsers")
+	var conditions []string
+	var params []any
+
+	addParam := func(value any) int {
+		params = append(params, value)
+		return len(params)
+	}
+
+	if !search.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if search.Role != "" {
+		conditions = append(conditions, fmt.Sprintf("role=$%d", addParam(search.Role)))
+	}
+	if search.AccountStatus != "" {
+		conditions = append(conditions, fmt.Sprintf("account_status=$%d", addParam(search.AccountStatus)))
+	}
+	if search.PhoneNumber != "" {
+		conditions = append(conditions, repo.phoneNumberCondition(addParam, search.PhoneNumber))
+	}
+
+	from := "users"
+	rank := "0"
+	if len(search.Terms) > 0 {
+		from += fmt.Sprintf(", to_tsquery('simple', $%d) query", addParam(prefixTsQuery(search.Terms)))
+		text := addParam(strings.ToLower(strings.Join(search.Terms, " ")))
+		matches := []string{
+			"search_vector @@ query",
+			fmt.Sprintf("$%[1]d <%% lower(full_name) OR $%[1]d <%% lower(username) OR $%[1]d <%% lower(email::text)", text),
+		}
+		for _, term := range search.Terms {
+			if phoneNumberRegex.MatchString(term) {
+				matches = append(matches, repo.phoneNumberCondition(addParam, term))
+			}
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+		rank = fmt.Sprintf("ts_rank(search_vector, query) + GREATEST(word_similarity($%[1]d, lower(full_name)), word_similarity($%[1]d, lower(username)), word_similarity($%[1]d, lower(email::text)), 0)", text)
+	}
+
+	offset := 0
+	if page.Cursor != "" {
+		key, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if offset, err = strconv.Atoi(key); err != nil || offset < 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = defaultUsersLimit
+	}
+	limit = min(limit, maxUsersLimit)
+
+	query := "SELECT id, role, email, password_hash, COALESCE(username, ''), COALESCE(full_name, ''), COALESCE(date_of_birth, '-infinity'), COALESCE(gender, ''), COALESCE(phone_number, ''), COALESCE(account_status, ''), COALESCE(image_url, ''), created_at, updated_at, version, deleted_at, " + rank + " AS rank FROM " + from
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page.
+	query += fmt.Sprintf(" ORDER BY rank DESC, id DESC LIMIT %d OFFSET %d;", limit+1, offset)
+
+	rows, err := repo.reader(ctx).QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+	for rows.Next() {
+		var result UserSearchResult
+		user := &result.User
+		if err = rows.Scan(&user.Id, &user.Role, &user.Email, &user.PasswordHash, &user.Username, &user.FullName, &user.DateOfBirth, &user.Gender, &user.PhoneNumber, &user.AccountStatus, &user.ImageUrl, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.DeletedAt, &result.Rank); err != nil {
+			return nil, translateError(err)
+		}
+		if err = repo.keyring.decryptUser(user); err != nil {
+			return nil, err
+		}
+		result.Highlights = highlightUser(user, search.Terms)
+		results = append(results, result)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	searchPage := &UserSearchPage{Results: results}
+	if len(results) > limit {
+		searchPage.Results = results[:limit]
+		searchPage.NextCursor = encodeCursor(strconv.Itoa(offset + limit))
+	}
+	return searchPage, nil
+}
+
+// phoneNumberCondition returns the condition matching the phone number exactly, using its blind index if the repo has a keyring.
+func (repo *Repo) phoneNumberCondition(addParam func(any) int, phoneNumber string) string {
+	if repo.keyring != nil {
+		return fmt.Sprintf("phone_number_hash=$%d", addParam(repo.keyring.blindIndex(phoneNumber)))
+	}
+	return fmt.Sprintf("phone_number=$%d", addParam(phoneNumber))
+}
+
+var tsQueryEscaper = strings.NewReplacer(`\`, `\\`, `'`, `''`)
+
+// prefixTsQuery returns a tsquery matching documents with words starting with all the terms. Terms are quoted, so that they cannot inject tsquery operators.
+func prefixTsQuery(terms []string) string {
+	lexemes := make([]string, len(terms))
+	for i, term := range terms {
+		lexemes[i] = "'" + tsQueryEscaper.Replace(strings.ToLower(term)) + "':*"
+	}
+	return strings.Join(lexemes, " & ")
+}
+
+// highlightUser returns the highlighted fields of the user that contain any of the terms.
+func highlightUser(user *User, terms []string) map[string]string {
+	var highlights map[string]string
+	for field, value := range map[string]string{"full_name": user.FullName, "username": user.Username, "email": user.Email} {
+		if highlighted, ok := highlight(value, terms); ok {
+			if highlights == nil {
+				highlights = map[string]string{}
+			}
+			highlights[field] = highlighted
+		}
+	}
+	return highlights
+}
+
+// highlight HTML escapes `value` and wraps the occurrences of the terms, ignoring case, in <mark> tags. It reports whether any term occurs.
+func highlight(value string, terms []string) (string, bool) {
+	lower := strings.ToLower(value)
+	// The lowercase value must have the same byte offsets as the value.
+	if len(lower) != len(value) {
+		return "", false
+	}
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		if term == "" {
+			continue
+		}
+		for i := 0; ; {
+			j := strings.Index(lower[i:], term)
+			if j < 0 {
+				break
+			}
+			spans = append(spans, span{i + j, i + j + len(term)})
+			i += j + len(term)
+		}
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	// Merge overlapping and adjacent spans.
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		if last := &merged[len(merged)-1]; s.start <= last.end {
+			last.end = max(last.end, s.end)
+		} else {
+			merged = append(merged, s)
+		}
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, s := range merged {
+		b.WriteString(html.EscapeString(value[prev:s.start]))
+		b.WriteString("<mark>" + html.EscapeString(value[s.start:s.end]) + "</mark>")
+		prev = s.end
+	}
+	b.WriteString(html.EscapeString(value[prev:]))
+	return b.String(), true
+}
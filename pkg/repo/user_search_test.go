@@ -0,0 +1,32 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserSearch(t *testing.T) {
+	tests := []struct {
+		query  string
+		search *repo.UserSearch
+	}{
+		{"", &repo.UserSearch{}},
+		{"john doe", &repo.UserSearch{Terms: []string{"john", "doe"}}},
+		{"role:admin status:active john", &repo.UserSearch{Terms: []string{"john"}, Role: "admin", AccountStatus: "active"}},
+		{"phone:+15551234567 Deleted:true", &repo.UserSearch{PhoneNumber: "+15551234567", IncludeDeleted: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			search, err := repo.ParseUserSearch(tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.search, search)
+		})
+	}
+
+	for _, query := range []string{"role:", "deleted:maybe", "name:john"} {
+		_, err := repo.ParseUserSearch(query)
+		assert.ErrorIs(t, err, repo.ErrInvalidSearchQuery, query)
+	}
+}
@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCron = errors.New("invalid cron expression")
+
+// Schedule returns the time of the next run after `t`.
+type Schedule interface {
+	Next(t time.Time) time.Time
+	String() string
+}
+
+type every time.Duration
+
+// Every runs a task at a fixed interval, starting one interval after the scheduler starts.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return "every " + time.Duration(e).String()
+}
+
+// cron is a parsed cron expression. Each field is a bit set of the values it matches.
+type cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+// cronFields are the bounds of the fields of a cron expression, in order.
+var cronFields = [...]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// ParseCron parses a standard five field cron expression: minute, hour, day of month, month and day of week, where Sunday is 0. Fields support `*`, values, ranges (`1-5`), lists (`1,15`) and steps (`*/15`, `0-30/10`). As in cron, a task runs when either the day of month or the day of week matches if both are restricted. Times are in the location of the time passed to Next.
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("%w: %q must have %d fields", ErrInvalidCron, expr, len(cronFields))
+	}
+	var sets [len(cronFields)]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s field %q: %w", ErrInvalidCron, cronFields[i].name, field, err)
+		}
+		sets[i] = set
+	}
+	return &cron{
+		expr:          expr,
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// MustParseCron is like ParseCron, but panics if the expression is invalid.
+func MustParseCron(expr string) Schedule {
+	s, err := ParseCron(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, errors.New("invalid step")
+			}
+		}
+		start, end := min, max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(startPart); err != nil {
+				return 0, errors.New("invalid value")
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(endPart); err != nil {
+					return 0, errors.New("invalid value")
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("values must be between %d and %d", min, max)
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule matches at least once in this many years, for example on the 29th of February.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cron) matchesDay(t time.Time) bool {
+	domMatches := c.dom&(1<<t.Day()) != 0
+	dowMatches := c.dow&(1<<t.Weekday()) != 0
+	if c.domRestricted && c.dowRestricted {
+		return domMatches || dowMatches
+	}
+	return domMatches && dowMatches
+}
+
+func (c *cron) String() string {
+	return c.expr
+}
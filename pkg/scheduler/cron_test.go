@@ -0,0 +1,46 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	// Wednesday
+	from := time.Date(2024, time.January, 10, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 10, 10, 18, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, time.January, 10, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 10, 10, 30, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2024, time.January, 11, 3, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, time.January, 10, 13, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week matches.
+		{"0 0 20 * 5", time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := scheduler.ParseCron(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.next, schedule.Next(from))
+			assert.Equal(t, tt.expr, schedule.String())
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 7", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+			_, err := scheduler.ParseCron(expr)
+			assert.ErrorIs(t, err, scheduler.ErrInvalidCron, expr)
+		}
+		assert.Panics(t, func() { scheduler.MustParseCron("* * *") })
+	})
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+)
+
+// Elector elects the instance that runs the tasks that must only run on one instance at a time.
+type Elector interface {
+	// IsLeader reports whether this instance is the leader, trying to become it if there is none.
+	IsLeader(ctx context.Context) bool
+}
+
+// PostgresElector elects a leader using a postgres session-level advisory lock. The leader holds the lock on a dedicated connection, so leadership passes to another instance as soon as that connection is lost, for example because the leader crashed.
+type PostgresElector struct {
+	db   *sql.DB
+	key  int64
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewPostgresElector creates an elector among the instances that use the same database and `name`.
+func NewPostgresElector(db *sql.DB, name string) *PostgresElector {
+	h := fnv.New64a()
+	h.Write([]byte("scheduler:" + name))
+	return &PostgresElector{db: db, key: int64(h.Sum64())}
+}
+
+func (e *PostgresElector) IsLeader(ctx context.Context) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn != nil {
+		if err := e.conn.PingContext(ctx); err == nil {
+			return true
+		}
+		slog.WarnContext(ctx, "Lost scheduler leadership")
+		// The connection is discarded instead of being returned to the pool, as it may still hold the lock.
+		_ = e.conn.Raw(func(any) error { return driver.ErrBadConn })
+		_ = e.conn.Close()
+		e.conn = nil
+	}
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "get connection for leader election", slog.Any("error", err))
+		return false
+	}
+	var locked bool
+	if err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1);`, e.key).Scan(&locked); err != nil || !locked {
+		if err != nil {
+			slog.ErrorContext(ctx, "try advisory lock", slog.Any("error", err))
+		}
+		_ = conn.Close()
+		return false
+	}
+	slog.InfoContext(ctx, "Became scheduler leader")
+	e.conn = conn
+	return true
+}
+
+// Close gives up leadership.
+func (e *PostgresElector) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	_, _ = e.conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, e.key)
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
@@ -0,0 +1,223 @@
+// Package scheduler runs named periodic tasks on cron schedules or at intervals.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Task is the function run by a scheduled task.
+type Task func(ctx context.Context) error
+
+type taskOpts struct {
+	jitter  time.Duration
+	timeout time.Duration
+	local   bool
+}
+
+// WithJitter delays each run by a random duration of up to `d`, so that instances and tasks scheduled at the same time do not run all at once.
+func WithJitter(d time.Duration) func(*taskOpts) {
+	return func(to *taskOpts) {
+		to.jitter = d
+	}
+}
+
+// WithTimeout cancels the context of a run after `d`.
+func WithTimeout(d time.Duration) func(*taskOpts) {
+	return func(to *taskOpts) {
+		to.timeout = d
+	}
+}
+
+// WithLocal runs the task on every instance instead of only on the leader, for tasks on state local to each instance such as an in-memory store.
+func WithLocal() func(*taskOpts) {
+	return func(to *taskOpts) {
+		to.local = true
+	}
+}
+
+type TaskStatus struct {
+	NextRunAt    time.Time  `json:"next_run_at"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+	Local        bool       `json:"local"`
+	Running      bool       `json:"running"`
+}
+
+type Status struct {
+	Tasks    []TaskStatus `json:"tasks"`
+	IsLeader bool         `json:"is_leader"`
+}
+
+type task struct {
+	fn       Task
+	schedule Schedule
+	opts     taskOpts
+	// status is guarded by the scheduler's mutex.
+	status TaskStatus
+}
+
+type schedulerOpts struct {
+	elector Elector
+}
+
+// WithElector runs the tasks that are not local only on the leader elected by `elector`. Without an elector, all tasks run on every instance.
+func WithElector(elector Elector) func(*schedulerOpts) {
+	return func(so *schedulerOpts) {
+		so.elector = elector
+	}
+}
+
+// Scheduler runs registered tasks on their schedules. Runs of a task never overlap: the next run is scheduled once the previous one has finished, and runs missed in the meantime are skipped.
+type Scheduler struct {
+	opts     schedulerOpts
+	mu       sync.Mutex
+	tasks    []*task
+	isLeader bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func New(optFuncs ...func(*schedulerOpts)) *Scheduler {
+	opts := schedulerOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return &Scheduler{opts: opts}
+}
+
+// Register adds a task named `name`. Register all tasks before calling Start. It panics if a task with the same name has already been registered.
+func (s *Scheduler) Register(name string, schedule Schedule, fn Task, optFuncs ...func(*taskOpts)) {
+	opts := taskOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.status.Name == name {
+			panic(fmt.Sprintf("scheduler: task %q is already registered", name))
+		}
+	}
+	s.tasks = append(s.tasks, &task{
+		fn:       fn,
+		schedule: schedule,
+		opts:     opts,
+		status:   TaskStatus{Name: name, Schedule: schedule.String(), Local: opts.local},
+	})
+}
+
+// Start runs the tasks until Stop is called or `ctx` is canceled.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, t)
+		}()
+	}
+}
+
+// Stop cancels the runs in progress and waits for them to return.
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) Status() *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := &Status{Tasks: make([]TaskStatus, len(s.tasks)), IsLeader: s.isLeader || s.opts.elector == nil}
+	for i, t := range s.tasks {
+		status.Tasks[i] = t.status
+	}
+	return status
+}
+
+func (s *Scheduler) loop(ctx context.Context, t *task) {
+	for {
+		next := t.schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.ErrorContext(ctx, "task schedule has no next run", slog.String("task", t.status.Name))
+			return
+		}
+		if t.opts.jitter > 0 {
+			next = next.Add(rand.N(t.opts.jitter))
+		}
+		s.mu.Lock()
+		t.status.NextRunAt = next
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if !t.opts.local && s.opts.elector != nil {
+			isLeader := s.opts.elector.IsLeader(ctx)
+			s.mu.Lock()
+			s.isLeader = isLeader
+			s.mu.Unlock()
+			if !isLeader {
+				continue
+			}
+		}
+		s.run(ctx, t)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, t *task) {
+	start := time.Now()
+	s.mu.Lock()
+	t.status.Running = true
+	t.status.LastRunAt = &start
+	s.mu.Unlock()
+
+	if t.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.opts.timeout)
+		defer cancel()
+	}
+	err := runTask(ctx, t.fn)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	t.status.Running = false
+	t.status.Runs++
+	t.status.LastDuration = duration.String()
+	t.status.LastError = ""
+	if err != nil {
+		t.status.Failures++
+		t.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		slog.ErrorContext(ctx, "scheduled task failed", slog.String("task", t.status.Name), slog.Duration("duration", duration), slog.Any("error", err))
+	} else {
+		slog.DebugContext(ctx, "Scheduled task ran", slog.String("task", t.status.Name), slog.Duration("duration", duration))
+	}
+}
+
+// runTask runs `fn`, turning panics into errors.
+func runTask(ctx context.Context, fn Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,97 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubElector bool
+
+func (e stubElector) IsLeader(ctx context.Context) bool {
+	return bool(e)
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("Run tasks", func(t *testing.T) {
+		s := scheduler.New()
+		var runs, failures atomic.Int32
+		s.Register("ok", scheduler.Every(time.Millisecond*10), func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		})
+		s.Register("fail", scheduler.Every(time.Millisecond*10), func(ctx context.Context) error {
+			failures.Add(1)
+			if failures.Load()%2 == 0 {
+				panic("boom")
+			}
+			return errors.New("failed")
+		})
+		s.Start(context.Background())
+		assert.Eventually(t, func() bool { return runs.Load() >= 2 && failures.Load() >= 2 }, time.Second, time.Millisecond*5)
+		s.Stop()
+
+		status := s.Status()
+		assert.True(t, status.IsLeader)
+		assert.Len(t, status.Tasks, 2)
+		assert.Equal(t, "ok", status.Tasks[0].Name)
+		assert.Equal(t, "every 10ms", status.Tasks[0].Schedule)
+		assert.Equal(t, int(runs.Load()), status.Tasks[0].Runs)
+		assert.Zero(t, status.Tasks[0].Failures)
+		assert.NotNil(t, status.Tasks[0].LastRunAt)
+		assert.Equal(t, status.Tasks[1].Runs, status.Tasks[1].Failures)
+		assert.NotEmpty(t, status.Tasks[1].LastError)
+	})
+
+	t.Run("Follower only runs local tasks", func(t *testing.T) {
+		s := scheduler.New(scheduler.WithElector(stubElector(false)))
+		var shared, local atomic.Int32
+		s.Register("shared", scheduler.Every(time.Millisecond*10), func(ctx context.Context) error {
+			shared.Add(1)
+			return nil
+		})
+		s.Register("local", scheduler.Every(time.Millisecond*10), func(ctx context.Context) error {
+			local.Add(1)
+			return nil
+		}, scheduler.WithLocal())
+		s.Start(context.Background())
+		assert.Eventually(t, func() bool { return local.Load() >= 3 }, time.Second, time.Millisecond*5)
+		s.Stop()
+
+		assert.Zero(t, shared.Load())
+		assert.False(t, s.Status().IsLeader)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		s := scheduler.New()
+		errs := make(chan error, 1)
+		s.Register("slow", scheduler.Every(time.Millisecond*10), func(ctx context.Context) error {
+			<-ctx.Done()
+			select {
+			case errs <- ctx.Err():
+			default:
+			}
+			return ctx.Err()
+		}, scheduler.WithTimeout(time.Millisecond*10))
+		s.Start(context.Background())
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		case <-time.After(time.Second):
+			t.Error("task was not timed out")
+		}
+		s.Stop()
+	})
+
+	t.Run("Duplicate name", func(t *testing.T) {
+		s := scheduler.New()
+		noop := func(ctx context.Context) error { return nil }
+		s.Register("task", scheduler.Every(time.Minute), noop)
+		assert.Panics(t, func() { s.Register("task", scheduler.Every(time.Minute), noop) })
+	})
+}
@@ -0,0 +1,46 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+var (
+	firstNames = [...]string{"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda", "David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Charles", "Karen", "Aarav", "Priya", "Wei", "Mei", "Hiroshi", "Yuki", "Carlos", "Sofia", "Mohammed", "Fatima", "Olusegun", "Amara", "Lars", "Ingrid", "Mateo", "Lucia"}
+	lastNames  = [...]string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson", "Anderson", "Taylor", "Thomas", "Moore", "Jackson", "Martin", "Lee", "Sharma", "Patel", "Wang", "Chen", "Tanaka", "Suzuki", "Silva", "Rossi", "Khan", "Ali", "Okafor", "Mensah", "Nilsson", "Berg", "Fernandez", "Costa"}
+	genders    = [...]string{"male", "female", "other"}
+)
+
+// FakeUsers generates `n` realistic users with the password hash `passwordHash`. The same `seed` generates the same users, so loading them again updates them instead of creating more.
+func FakeUsers(n int, seed uint64, passwordHash string) []User {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	users := make([]User, n)
+	for i := range users {
+		first := firstNames[rng.IntN(len(firstNames))]
+		last := lastNames[rng.IntN(len(lastNames))]
+		// The index keeps emails and usernames unique.
+		handle := fmt.Sprintf("%s.%s%d", strings.ToLower(first), strings.ToLower(last), i)
+
+		user := User{
+			Email:         handle + "@example.com",
+			PasswordHash:  passwordHash,
+			Role:          "user",
+			FullName:      first + " " + last,
+			Username:      handle[:min(len(handle), 32)],
+			DateOfBirth:   time.Date(1950+rng.IntN(55), time.Month(1+rng.IntN(12)), 1+rng.IntN(28), 0, 0, 0, 0, time.UTC).Format(time.DateOnly),
+			Gender:        genders[rng.IntN(len(genders))],
+			PhoneNumber:   fmt.Sprintf("+1555%07d", rng.IntN(10_000_000)),
+			AccountStatus: "active",
+		}
+		if rng.IntN(50) == 0 {
+			user.Role = "admin"
+		}
+		if rng.IntN(20) == 0 {
+			user.AccountStatus = "suspended"
+		}
+		users[i] = user
+	}
+	return users
+}
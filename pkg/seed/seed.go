@@ -0,0 +1,253 @@
+// Package seed loads fixtures of users and blob objects, for local development and tests.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown fixtures format")
+	ErrNoObjectStore = errors.New("fixtures have objects but there is no object store")
+)
+
+// passwordHashCost is the bcrypt cost of the passwords of fixtures, the same as for users signing up.
+const passwordHashCost = 12
+
+// Fixtures are the users and objects to load.
+type Fixtures struct {
+	Users   []User   `json:"users" yaml:"users"`
+	Objects []Object `json:"objects" yaml:"objects"`
+}
+
+// User is a user fixture. Users are identified by their email.
+type User struct {
+	Email string `json:"email" yaml:"email"`
+	// Password is hashed when loading. PasswordHash is used as is if Password is empty.
+	Password      string `json:"password" yaml:"password"`
+	PasswordHash  string `json:"passwordHash" yaml:"passwordHash"`
+	Role          string `json:"role" yaml:"role"`
+	FullName      string `json:"fullName" yaml:"fullName"`
+	Username      string `json:"username" yaml:"username"`
+	DateOfBirth   string `json:"dateOfBirth" yaml:"dateOfBirth"`
+	Gender        string `json:"gender" yaml:"gender"`
+	PhoneNumber   string `json:"phoneNumber" yaml:"phoneNumber"`
+	AccountStatus string `json:"accountStatus" yaml:"accountStatus"`
+	ImageUrl      string `json:"imageUrl" yaml:"imageUrl"`
+}
+
+// Object is a blob object fixture. Its content is either Content or the file at Path, relative to the fixtures file.
+type Object struct {
+	// Bucket defaults to the default bucket of the loader.
+	Bucket      string `json:"bucket" yaml:"bucket"`
+	Key         string `json:"key" yaml:"key"`
+	ContentType string `json:"contentType" yaml:"contentType"`
+	Content     string `json:"content" yaml:"content"`
+	Path        string `json:"path" yaml:"path"`
+}
+
+// Parse parses fixtures in `format`, "json" or "yaml".
+func Parse(data []byte, format string) (*Fixtures, error) {
+	fixtures := &Fixtures{}
+	var err error
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(fixtures)
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(fixtures); err == io.EOF {
+			err = nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s fixtures: %w", format, err)
+	}
+	return fixtures, nil
+}
+
+// LoadFile reads the fixtures file at `name` in `fsys`. The format is guessed from the extension: .json, .yaml or .yml. The content of objects with a Path is read relative to the file.
+func LoadFile(fsys fs.FS, name string) (*Fixtures, error) {
+	var format string
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		format = "json"
+	case ".yaml", ".yml":
+		format = "yaml"
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	fixtures, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for i := range fixtures.Objects {
+		object := &fixtures.Objects[i]
+		if object.Path == "" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(path.Dir(name), object.Path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: read object %q: %w", name, object.Key, err)
+		}
+		object.Content = string(content)
+		object.Path = ""
+	}
+	return fixtures, nil
+}
+
+// LoadPath reads the fixtures file at `name` on the OS file system, as LoadFile.
+func LoadPath(name string) (*Fixtures, error) {
+	dir, file := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	return LoadFile(os.DirFS(dir), file)
+}
+
+// ObjectStore stores blob objects. It is implemented by *blobstore.Store.
+type ObjectStore interface {
+	PutObject(ctx context.Context, bucketName string, fileName string, contentType string, body io.Reader) error
+}
+
+type loaderOpts struct {
+	objects       ObjectStore
+	defaultBucket string
+}
+
+// WithObjectStore stores the objects of fixtures in `objects`, in `defaultBucket` unless they set their bucket.
+func WithObjectStore(objects ObjectStore, defaultBucket string) func(*loaderOpts) {
+	return func(lo *loaderOpts) {
+		lo.objects = objects
+		lo.defaultBucket = defaultBucket
+	}
+}
+
+// Loader loads fixtures idempotently: users that already exist are updated to match their fixture, and objects are overwritten.
+type Loader struct {
+	users repo.UserRepo
+	opts  loaderOpts
+}
+
+func NewLoader(users repo.UserRepo, optFuncs ...func(*loaderOpts)) *Loader {
+	opts := loaderOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+	return &Loader{users: users, opts: opts}
+}
+
+// Result counts what Load did.
+type Result struct {
+	UsersCreated int
+	UsersUpdated int
+	Objects      int
+}
+
+// Load loads the fixtures. It stops at the first error, and can be run again once it has been fixed.
+func (l *Loader) Load(ctx context.Context, fixtures *Fixtures) (*Result, error) {
+	if len(fixtures.Objects) > 0 && l.opts.objects == nil {
+		return nil, ErrNoObjectStore
+	}
+	result := &Result{}
+	for i := range fixtures.Users {
+		created, err := l.loadUser(ctx, &fixtures.Users[i])
+		if err != nil {
+			return result, fmt.Errorf("load user %q: %w", fixtures.Users[i].Email, err)
+		}
+		if created {
+			result.UsersCreated++
+		} else {
+			result.UsersUpdated++
+		}
+	}
+	for _, object := range fixtures.Objects {
+		bucket := object.Bucket
+		if bucket == "" {
+			bucket = l.opts.defaultBucket
+		}
+		if err := l.opts.objects.PutObject(ctx, bucket, object.Key, object.ContentType, strings.NewReader(object.Content)); err != nil {
+			return result, fmt.Errorf("load object %q: %w", object.Key, err)
+		}
+		result.Objects++
+	}
+	return result, nil
+}
+
+// loadUser creates the user of the fixture, or updates it if it exists. It reports whether the user was created.
+func (l *Loader) loadUser(ctx context.Context, fixture *User) (bool, error) {
+	user, err := l.users.GetUserByEmail(ctx, fixture.Email)
+	if err != nil && !errors.Is(err, repo.ErrUserNotFound) {
+		return false, err
+	}
+
+	// Passwords are only hashed again if they changed, as each hash is different.
+	passwordHash := fixture.PasswordHash
+	if fixture.Password != "" && (user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(fixture.Password)) != nil) {
+		hash, err := bcrypt.GenerateFromPassword([]byte(fixture.Password), passwordHashCost)
+		if err != nil {
+			return false, err
+		}
+		passwordHash = string(hash)
+	}
+
+	userId := ""
+	updates := map[string]any{}
+	if user == nil {
+		if passwordHash == "" {
+			return false, errors.New("user has no password")
+		}
+		if userId, err = l.users.CreateUser(ctx, &repo.UserCore{Email: fixture.Email, PasswordHash: passwordHash, Role: fixture.Role}); err != nil {
+			return false, err
+		}
+	} else {
+		userId = user.Id
+		if passwordHash != "" {
+			updates["password_hash"] = passwordHash
+		}
+		if fixture.Role != "" {
+			updates["role"] = fixture.Role
+		}
+	}
+
+	for column, value := range map[string]string{
+		"full_name":      fixture.FullName,
+		"username":       fixture.Username,
+		"date_of_birth":  fixture.DateOfBirth,
+		"gender":         fixture.Gender,
+		"phone_number":   fixture.PhoneNumber,
+		"account_status": fixture.AccountStatus,
+		"image_url":      fixture.ImageUrl,
+	} {
+		if value != "" {
+			updates[column] = value
+		}
+	}
+	if len(updates) > 0 {
+		if err = l.users.Update(ctx, userId, updates); err != nil {
+			return false, err
+		}
+	}
+	return user == nil, nil
+}
@@ -0,0 +1,117 @@
+package seed_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/rohitxdev/go-api-starter/pkg/seed"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memoryObjectStore struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (s *memoryObjectStore) PutObject(ctx context.Context, bucketName string, fileName string, contentType string, body io.Reader) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucketName+"/"+fileName] = string(content)
+	return nil
+}
+
+func newUserRepo(t *testing.T) *repo.SqliteUserRepo {
+	db, err := database.NewSqlite(":memory:")
+	assert.Nil(t, err)
+	m, err := migrate.New(db, repo.SqliteMigrations, migrate.WithDialect(migrate.SQLite))
+	assert.Nil(t, err)
+	assert.Nil(t, m.Up(context.Background(), 0))
+	users := repo.NewSqliteUserRepo(db)
+	t.Cleanup(func() { users.Close() })
+	return users
+}
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+	users := newUserRepo(t)
+	objects := &memoryObjectStore{objects: map[string]string{}}
+	loader := seed.NewLoader(users, seed.WithObjectStore(objects, "assets"))
+
+	fixtures, err := seed.LoadFile(os.DirFS("testdata"), "fixtures.yaml")
+	assert.Nil(t, err)
+
+	result, err := loader.Load(ctx, fixtures)
+	assert.Nil(t, err)
+	assert.Equal(t, &seed.Result{UsersCreated: 2, Objects: 2}, result)
+
+	admin, err := users.GetUserByEmail(ctx, "admin@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", admin.Role)
+	assert.Equal(t, "Ada Admin", admin.FullName)
+	assert.Nil(t, bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte("password")))
+
+	user, err := users.GetUserByEmail(ctx, "user@example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "user", user.Role)
+	assert.Equal(t, "suspended", user.AccountStatus)
+
+	assert.Equal(t, map[string]string{
+		"assets/avatars/ada.svg": "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"1\" height=\"1\"/>\n",
+		"public/hello.txt":       "Hello",
+	}, objects.objects)
+
+	t.Run("Idempotent", func(t *testing.T) {
+		result, err := loader.Load(ctx, fixtures)
+		assert.Nil(t, err)
+		assert.Equal(t, &seed.Result{UsersUpdated: 2, Objects: 2}, result)
+
+		reloaded, err := users.GetUserByEmail(ctx, "admin@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, admin.PasswordHash, reloaded.PasswordHash)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		fixtures, err := seed.Parse([]byte(`{"users": [{"email": "json@example.com", "passwordHash": "hash", "username": "json"}]}`), "json")
+		assert.Nil(t, err)
+		result, err := seed.NewLoader(users).Load(ctx, fixtures)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, result.UsersCreated)
+
+		_, err = seed.Parse([]byte(`{"users": [{"name": "json"}]}`), "json")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Objects without an object store", func(t *testing.T) {
+		_, err := seed.NewLoader(users).Load(ctx, fixtures)
+		assert.ErrorIs(t, err, seed.ErrNoObjectStore)
+	})
+}
+
+func TestFakeUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newUserRepo(t)
+
+	fake := seed.FakeUsers(100, 1, "hash")
+	assert.Len(t, fake, 100)
+	assert.Equal(t, fake, seed.FakeUsers(100, 1, "hash"))
+
+	loader := seed.NewLoader(users)
+	result, err := loader.Load(ctx, &seed.Fixtures{Users: fake})
+	assert.Nil(t, err)
+	assert.Equal(t, 100, result.UsersCreated)
+
+	result, err = loader.Load(ctx, &seed.Fixtures{Users: fake})
+	assert.Nil(t, err)
+	assert.Equal(t, 100, result.UsersUpdated)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+)
+
+const reencryptUsage = `Usage: %s reencrypt [flags]
+
+Re-encrypt the PII of users that is in plaintext or encrypted with an older key using the key piiKeyId. Run it after rotating the key. It is safe to run while the server is serving requests and to interrupt.
+
+Flags:
+`
+
+// newKeyring returns the keyring of the PII keys in the config, or nil if encryption is disabled.
+func newKeyring(c *config.Server) (*repo.Keyring, error) {
+	if c.PiiKeyId == "" {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(c.PiiKeys))
+	for id, key := range c.PiiKeys {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("decode pii key %q: %w", id, err)
+		}
+		keys[id] = decoded
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(c.PiiIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode pii index key: %w", err)
+	}
+	return repo.NewKeyring(keys, c.PiiKeyId, indexKey)
+}
+
+// runReencrypt runs the reencrypt subcommand with the given arguments.
+func runReencrypt(c *config.Server, args []string) error {
+	flags := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	batchSize := flags.Int("batch-size", 500, "number of users to read at a time")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), reencryptUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if c.DatabaseDriver == config.DatabaseSqlite {
+		return errors.New("PII encryption is not supported with sqlite")
+	}
+	keyring, err := newKeyring(c)
+	if err != nil {
+		return err
+	}
+	if keyring == nil {
+		return errors.New("piiKeyId is not set")
+	}
+
+	db, err := database.NewPostgres(c.DatabaseUrl)
+	if err != nil {
+		return err
+	}
+	r := repo.New(db, repo.WithKeyring(keyring))
+	defer r.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	n, err := r.ReencryptUsers(ctx, *batchSize)
+	fmt.Printf("Re-encrypted %d users\n", n)
+	return err
+}
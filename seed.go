@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/rohitxdev/go-api-starter/internal/config"
+	"github.com/rohitxdev/go-api-starter/pkg/blobstore"
+	"github.com/rohitxdev/go-api-starter/pkg/database"
+	"github.com/rohitxdev/go-api-starter/pkg/migrate"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/rohitxdev/go-api-starter/pkg/seed"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const seedUsage = `Usage: %s seed [flags] [fixtures...]
+
+Load users and blob objects from YAML or JSON fixtures files, and generate fake users. Users that already exist are updated, so it is safe to run again.
+
+Flags:
+`
+
+// runSeed runs the seed subcommand with the given arguments.
+func runSeed(c *config.Server, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fake := flags.Int("fake", 0, "number of fake users to generate")
+	fakeSeed := flags.Uint64("fake-seed", 1, "seed of the fake users, the same seed generates the same users")
+	fakePassword := flags.String("fake-password", "password", "password of the fake users")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), seedUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 && *fake == 0 {
+		flags.Usage()
+		return errors.New("no fixtures to load")
+	}
+
+	fixtures := &seed.Fixtures{}
+	for _, name := range flags.Args() {
+		f, err := seed.LoadPath(name)
+		if err != nil {
+			return err
+		}
+		fixtures.Users = append(fixtures.Users, f.Users...)
+		fixtures.Objects = append(fixtures.Objects, f.Objects...)
+	}
+	if *fake > 0 {
+		// All fake users share the hash, as hashing is slow on purpose.
+		hash, err := bcrypt.GenerateFromPassword([]byte(*fakePassword), bcrypt.MinCost)
+		if err != nil {
+			return err
+		}
+		fixtures.Users = append(fixtures.Users, seed.FakeUsers(*fake, *fakeSeed, string(hash))...)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var users repo.UserRepo
+	switch c.DatabaseDriver {
+	case config.DatabaseSqlite:
+		db, err := database.NewSqlite(c.DatabaseUrl)
+		if err != nil {
+			return err
+		}
+		m, err := migrate.New(db, repo.SqliteMigrations, migrate.WithDialect(migrate.SQLite))
+		if err != nil {
+			return err
+		}
+		if err = m.Up(ctx, 0); err != nil {
+			return err
+		}
+		sqliteUsers := repo.NewSqliteUserRepo(db)
+		defer sqliteUsers.Close()
+		users = sqliteUsers
+	default:
+		keyring, err := newKeyring(c)
+		if err != nil {
+			return err
+		}
+		db, err := database.NewPostgres(c.DatabaseUrl)
+		if err != nil {
+			return err
+		}
+		r := repo.New(db, repo.WithKeyring(keyring))
+		defer r.Close()
+		users = r
+	}
+
+	loader := seed.NewLoader(users)
+	if len(fixtures.Objects) > 0 {
+		objects, err := blobstore.New(c.S3Endpoint, c.S3DefaultRegion, c.AwsAccessKeyId, c.AwsAccessKeySecret)
+		if err != nil {
+			return err
+		}
+		loader = seed.NewLoader(users, seed.WithObjectStore(objects, c.S3BucketName))
+	}
+
+	result, err := loader.Load(ctx, fixtures)
+	if result != nil {
+		fmt.Printf("Created %d users, updated %d users and stored %d objects\n", result.UsersCreated, result.UsersUpdated, result.Objects)
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rohitxdev/go-api-starter/pkg/kvstore"
+	"github.com/rohitxdev/go-api-starter/pkg/repo"
+	"github.com/rohitxdev/go-api-starter/pkg/scheduler"
+)
+
+// registerTasks registers the periodic maintenance tasks. The tasks that need the postgres repo are only registered if `r` is not nil.
+func registerTasks(s *scheduler.Scheduler, kv kvstore.Store, r *repo.Repo) {
+	// SQLite and memory stores are local to each instance, so every instance purges its own. Redis expires keys by itself.
+	s.Register("kv_purge", scheduler.Every(time.Minute*5), func(ctx context.Context) error {
+		n, err := kv.Purge(ctx)
+		if err == nil && n > 0 {
+			slog.DebugContext(ctx, "Purged KV store", slog.Int64("keys", n))
+		}
+		return err
+	}, scheduler.WithLocal())
+
+	if r == nil {
+		return
+	}
+
+	s.Register("expired_invite_cleanup", scheduler.MustParseCron("0 * * * *"), func(ctx context.Context) error {
+		n, err := r.DeleteExpiredInvites(ctx)
+		if err == nil && n > 0 {
+			slog.InfoContext(ctx, "Deleted expired invites", slog.Int64("invites", n))
+		}
+		return err
+	}, scheduler.WithJitter(time.Minute), scheduler.WithTimeout(time.Minute*5))
+
+	s.Register("deleted_user_purge", scheduler.MustParseCron("30 3 * * *"), func(ctx context.Context) error {
+		n, err := r.PurgeDeletedUsers(ctx, time.Now().Add(-repo.DeletedUserRetention))
+		if err == nil && n > 0 {
+			slog.InfoContext(ctx, "Purged deleted users", slog.Int64("users", n))
+		}
+		return err
+	}, scheduler.WithJitter(time.Minute*10), scheduler.WithTimeout(time.Minute*30))
+
+	s.Register("delivered_outbox_event_purge", scheduler.MustParseCron("15 3 * * *"), func(ctx context.Context) error {
+		n, err := r.DeleteDeliveredOutboxEvents(ctx, time.Now().Add(-repo.DeliveredOutboxEventRetention))
+		if err == nil && n > 0 {
+			slog.InfoContext(ctx, "Deleted delivered outbox events", slog.Int64("events", n))
+		}
+		return err
+	}, scheduler.WithJitter(time.Minute*10), scheduler.WithTimeout(time.Minute*30))
+
+	s.Register("finished_job_purge", scheduler.MustParseCron("45 3 * * *"), func(ctx context.Context) error {
+		n, err := r.DeleteFinishedJobs(ctx, time.Now().Add(-repo.FinishedJobRetention))
+		if err == nil && n > 0 {
+			slog.InfoContext(ctx, "Deleted finished jobs", slog.Int64("jobs", n))
+		}
+		return err
+	}, scheduler.WithJitter(time.Minute*10), scheduler.WithTimeout(time.Minute*30))
+}